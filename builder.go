@@ -0,0 +1,161 @@
+package hashring
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError lists every problem found in a batch of changes, or by
+// HashRingCluster.Validate in a cluster.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "INVALIDINPUT: " + strings.Join(e.Problems, "; ")
+}
+
+// RingBuilder collects membership changes and applies them with a single
+// rebuild. Changes are validated as a whole, Build either applies all of
+// them or none.
+type RingBuilder struct {
+	base     *HashRing
+	nodes    []string
+	weights  map[string]int
+	removed  map[string]bool
+	changed  bool
+	problems []string
+}
+
+// Builder returns a RingBuilder that starts from the nodes and weights of h.
+func (h *HashRing) Builder() *RingBuilder {
+	nodes := make([]string, len(h.nodes))
+	copy(nodes, h.nodes)
+
+	weights := make(map[string]int, len(h.weights))
+	for node, weight := range h.weights {
+		weights[node] = weight
+	}
+
+	return &RingBuilder{
+		base:    h,
+		nodes:   nodes,
+		weights: weights,
+		removed: make(map[string]bool),
+	}
+}
+
+// Edit applies the changes made by fn with a single rebuild. On error h is
+// returned unchanged.
+func (h *HashRing) Edit(fn func(tx *RingBuilder)) (*HashRing, error) {
+	tx := h.Builder()
+	fn(tx)
+	return tx.Build()
+}
+
+func (b *RingBuilder) has(node string) bool {
+	for _, eNode := range b.nodes {
+		if eNode == node {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *RingBuilder) problem(format string, args ...interface{}) *RingBuilder {
+	b.problems = append(b.problems, fmt.Sprintf(format, args...))
+	return b
+}
+
+func (b *RingBuilder) AddNode(node string) *RingBuilder {
+	return b.AddWeightedNode(node, 1)
+}
+
+func (b *RingBuilder) AddWeightedNode(node string, weight int) *RingBuilder {
+	if weight <= 0 {
+		return b.problem("add %s: weight %d must be > 0", node, weight)
+	}
+	if b.has(node) {
+		return b.problem("add %s: node already exists", node)
+	}
+
+	b.nodes = append(b.nodes, node)
+	b.weights[node] = weight
+	b.changed = true
+	return b
+}
+
+// UpdateWeightedNode changes the weight of node. Unlike
+// HashRing.UpdateWeightedNode it also works for nodes that were added
+// without an explicit weight.
+func (b *RingBuilder) UpdateWeightedNode(node string, weight int) *RingBuilder {
+	if weight <= 0 {
+		return b.problem("update %s: weight %d must be > 0", node, weight)
+	}
+	if !b.has(node) {
+		return b.problem("update %s: node does not exist", node)
+	}
+
+	if oldWeight, ok := b.weights[node]; !ok || oldWeight != weight {
+		b.weights[node] = weight
+		b.changed = true
+	}
+	return b
+}
+
+func (b *RingBuilder) RemoveNode(node string) *RingBuilder {
+	if !b.has(node) {
+		return b.problem("remove %s: node does not exist", node)
+	}
+
+	nodes := make([]string, 0, len(b.nodes))
+	for _, eNode := range b.nodes {
+		if eNode != node {
+			nodes = append(nodes, eNode)
+		}
+	}
+	b.nodes = nodes
+	delete(b.weights, node)
+	b.removed[node] = true
+	b.changed = true
+	return b
+}
+
+// Build validates the collected changes and returns the new ring. On error
+// the base ring is returned together with a *ValidationError.
+func (b *RingBuilder) Build() (*HashRing, error) {
+	if len(b.problems) > 0 {
+		problems := make([]string, len(b.problems))
+		copy(problems, b.problems)
+		return b.base, &ValidationError{Problems: problems}
+	}
+
+	if !b.changed {
+		return b.base, nil
+	}
+
+	nodes := make([]string, len(b.nodes))
+	copy(nodes, b.nodes)
+	weights := make(map[string]int, len(b.weights))
+	for node, weight := range b.weights {
+		weights[node] = weight
+	}
+
+	hashRing := b.base.rebuild(nodes, weights)
+
+	dropMetadata := false
+	for node := range b.removed {
+		if _, ok := b.base.config.metadata[node]; ok {
+			dropMetadata = true
+		}
+	}
+	if dropMetadata {
+		hashRing.config.metadata = make(map[string]map[string]string, len(b.base.config.metadata))
+		for eNode, md := range b.base.config.metadata {
+			if !b.removed[eNode] {
+				hashRing.config.metadata[eNode] = md
+			}
+		}
+	}
+	return hashRing, nil
+}
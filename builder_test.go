@@ -0,0 +1,79 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestRingBuilderMatchesMutators(t *testing.T) {
+	ring := New([]string{"a", "b", "c", "d"})
+
+	expected := ring.RemoveNode("b").RemoveNode("c").
+		AddNode("e").AddWeightedNode("f", 3).UpdateWeightedNode("f", 2)
+
+	actual, err := ring.Builder().
+		RemoveNode("b").
+		RemoveNode("c").
+		AddNode("e").
+		AddWeightedNode("f", 3).
+		UpdateWeightedNode("f", 2).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed %v", err)
+	}
+
+	if actual.Size() != 4 {
+		t.Errorf("Size() expected 4 but got %d", actual.Size())
+	}
+	expectSamePlacement(t, expected, actual)
+	expectSamePlacement(t, New([]string{"a", "b", "c", "d"}), ring)
+}
+
+func TestRingEdit(t *testing.T) {
+	ring := NewRing([]string{"a", "b"}, WithNodeMetadata("a", map[string]string{"zone": "1"}))
+
+	edited, err := ring.Edit(func(tx *RingBuilder) {
+		tx.RemoveNode("a")
+		tx.AddNode("c")
+	})
+	if err != nil {
+		t.Fatalf("Edit failed %v", err)
+	}
+	expectSamePlacement(t, ring.RemoveNode("a").AddNode("c"), edited)
+	if edited.Metadata("a") != nil {
+		t.Errorf("Edit kept metadata of removed node %v", edited.Metadata("a"))
+	}
+}
+
+func TestRingBuilderValidation(t *testing.T) {
+	ring := New([]string{"a", "b"})
+
+	edited, err := ring.Edit(func(tx *RingBuilder) {
+		tx.AddNode("c")
+		tx.AddNode("a")
+		tx.RemoveNode("x")
+		tx.UpdateWeightedNode("y", 2)
+		tx.AddWeightedNode("d", 0)
+	})
+	if err == nil {
+		t.Fatal("Edit should fail")
+	}
+	if edited != ring {
+		t.Error("Edit should return the original ring on error")
+	}
+
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError but got %T", err)
+	}
+	if len(verr.Problems) != 4 {
+		t.Errorf("expected 4 problems but got %v", verr.Problems)
+	}
+}
+
+func TestRingBuilderNoChanges(t *testing.T) {
+	ring := New([]string{"a", "b"})
+	built, err := ring.Builder().Build()
+	if err != nil || built != ring {
+		t.Errorf("empty Build expected the same ring but got %v, %v", built, err)
+	}
+}
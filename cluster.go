@@ -3,14 +3,37 @@ package hashring
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+var (
+	ErrInvalidInput   = errors.New("INVALIDINPUT")
+	ErrServerNotFound = errors.New("SERVERNOTFOUND")
+	ErrNoServers      = errors.New("NOSERVERS")
+	ErrServerExists   = errors.New("SERVEREXISTS")
+	// ErrUnassignedVNode is returned when a key lands on a virtual node
+	// without a server and the UnassignedPolicy does not resolve it.
+	ErrUnassignedVNode = errors.New("UNASSIGNEDVNODE")
+	// ErrNotEnoughServers is returned when fewer servers own virtual nodes
+	// than replicas were asked for.
+	ErrNotEnoughServers = errors.New("NOTENOUGHSERVERS")
+)
+
+// BlackHole is returned by GetServer for keys without a server.
+const BlackHole = "BlackHole"
+
 type ServerInfo struct {
 	name         string
 	idx          int
 	virtualNodes []*VirtualNodeInfo
+	// weight is the capacity of the server, Rebalance hands out virtual nodes
+	// in proportion to it. New servers have weight 1.
+	weight float64
 }
 
 type VirtualNodeInfo struct {
@@ -19,15 +42,78 @@ type VirtualNodeInfo struct {
 	serverInfo *ServerInfo
 }
 
+// VNodeMove records a virtual node changing owner. An empty From or To
+// means the virtual node was or becomes unassigned.
+type VNodeMove struct {
+	VNode int    `json:"vnode"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to,omitempty"`
+}
+
+type RemoveMode int
+
+const (
+	// RemoveUnassign leaves the virtual nodes of the server unassigned.
+	RemoveUnassign RemoveMode = iota
+	// RemoveSpread hands each virtual node to the remaining server with the
+	// fewest virtual nodes for its weight, servers with weight 0 get none.
+	RemoveSpread
+	// RemoveToSuccessor hands all virtual nodes to RemovePolicy.Successor.
+	RemoveToSuccessor
+)
+
+// RemovePolicy decides where the virtual nodes of a removed server go.
+type RemovePolicy struct {
+	Mode      RemoveMode
+	Successor string
+}
+
+type UnassignedMode int
+
+const (
+	// UnassignedError fails lookups that land on a virtual node without a
+	// server.
+	UnassignedError UnassignedMode = iota
+	// UnassignedDefault routes them to UnassignedPolicy.Server.
+	UnassignedDefault
+	// UnassignedNextAssigned routes them to the server of the next assigned
+	// virtual node clockwise on the ring.
+	UnassignedNextAssigned
+)
+
+// UnassignedPolicy decides where keys of virtual nodes without a server go.
+type UnassignedPolicy struct {
+	Mode   UnassignedMode `json:"mode"`
+	Server string         `json:"server,omitempty"`
+}
+
 type HashRingCluster struct {
 	ring                   *HashRing
 	numberOfVirtualNodes   int
 	servers                []*ServerInfo
 	virtualToServerMapping map[string]*ServerInfo
 	virtualNodes           []*VirtualNodeInfo
+	unassignedPolicy       UnassignedPolicy
+	journal                clusterJournal
+	// generation counts the changes to the cluster, plans made at an older
+	// generation are stale.
+	generation uint64
+	// slots is set in Redis Cluster slot mode, keys then map to virtual
+	// nodes by KeySlot and there is no ring.
+	slots bool
+	// migrations maps migrating virtual nodes to their target server.
+	migrations map[int]string
+
+	// mu serializes changes, lookups read the published view instead.
+	mu   sync.Mutex
+	view atomic.Value
 }
 
 func NewHashRingCluster(numberOfVirtualNodes int) *HashRingCluster {
+	return newCluster(numberOfVirtualNodes, false)
+}
+
+func newCluster(numberOfVirtualNodes int, slots bool) *HashRingCluster {
 	cluster := &HashRingCluster{}
 	cluster.servers = []*ServerInfo{}
 	cluster.virtualToServerMapping = map[string]*ServerInfo{}
@@ -45,8 +131,12 @@ func NewHashRingCluster(numberOfVirtualNodes int) *HashRingCluster {
 		cluster.virtualNodes = append(cluster.virtualNodes, virtualNodeInfo)
 	}
 
-	cluster.ring = New(nodeNames)
+	cluster.slots = slots
+	if !slots {
+		cluster.ring = New(nodeNames)
+	}
 
+	cluster.publish()
 	return cluster
 }
 
@@ -66,59 +156,468 @@ func parseRange(r string) (start, end int, err error) {
 	return
 }
 
+// removeVirtualNode removes the virtual node idx from vnodes, which are
+// returned unchanged if it is not there.
 func removeVirtualNode(vnodes []*VirtualNodeInfo, idx int) []*VirtualNodeInfo {
-	i := 0
-	for i = 0; i < len(vnodes); i++ {
+	for i := 0; i < len(vnodes); i++ {
 		if vnodes[i].idx == idx {
-			break
+			return append(vnodes[:i], vnodes[i+1:]...)
+		}
+	}
+	return vnodes
+}
+
+// vnodeRange is the virtual nodes start to end, both included.
+type vnodeRange struct {
+	start int
+	end   int
+}
+
+// parseRanges parses a comma separated list of ranges and single virtual
+// nodes, e.g. "0-3,7,12-15", without expanding the ranges.
+func parseRanges(r string) ([]vnodeRange, error) {
+	ranges := []vnodeRange{}
+	for _, part := range strings.Split(r, ",") {
+		if !strings.Contains(part, "-") {
+			vnode, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, vnodeRange{vnode, vnode})
+			continue
+		}
+
+		start, end, err := parseRange(part)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, ErrInvalidInput
+		}
+		ranges = append(ranges, vnodeRange{start, end})
+	}
+	return ranges, nil
+}
+
+// parseRangeList parses a range list, see parseRanges, into the virtual
+// nodes it lists. Every range must lie within numberOfVirtualNodes, which is
+// checked before any range is expanded.
+func parseRangeList(r string, numberOfVirtualNodes int) ([]int, error) {
+	ranges, err := parseRanges(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, vr := range ranges {
+		if vr.start < 0 || vr.end >= numberOfVirtualNodes {
+			return nil, ErrInvalidInput
+		}
+	}
+
+	vnodes := []int{}
+	for _, vr := range ranges {
+		for i := vr.start; i <= vr.end; i++ {
+			vnodes = append(vnodes, i)
+		}
+	}
+	return vnodes, nil
+}
+
+// formatVNodes is the inverse of parseRangeList, runs of consecutive virtual
+// nodes are written as ranges.
+func formatVNodes(vnodes []int) string {
+	parts := []string{}
+	for i := 0; i < len(vnodes); {
+		j := i
+		for j+1 < len(vnodes) && vnodes[j+1] == vnodes[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", vnodes[i], vnodes[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(vnodes[i]))
 		}
+		i = j + 1
 	}
-	return append(vnodes[:i], vnodes[i+1:]...)
+	return strings.Join(parts, ",")
 }
 
 /*AddServer
-  rangeString: a-b where a and b are integers >= 0
+  rangeString: a-b where a and b are integers >= 0, or a comma separated
+  list of such ranges and single virtual nodes like 0-3,7,12-15
 */
 func (hc *HashRingCluster) AddServer(name string, rangeString string) error {
-	start, end, err := parseRange(rangeString)
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	vnodes, err := parseRangeList(rangeString, hc.numberOfVirtualNodes)
 	if err != nil {
 		return err
 	}
+	_, err = hc.record("add", []string{name, rangeString}, func() ([]VNodeMove, error) {
+		return hc.assignVNodes(name, vnodes)
+	})
+	return err
+}
+
+// AssignVNodes hands vnodes to the server name, which is created if it does
+// not exist yet. The whole list is validated before anything changes.
+func (hc *HashRingCluster) AssignVNodes(name string, vnodes []int) error {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
 
-	if start < 0 || start >= hc.numberOfVirtualNodes || start > end || end < 0 || end >= hc.numberOfVirtualNodes {
-		return errors.New("INVALIDINPUT")
+	_, err := hc.record("assign", []string{name, formatVNodes(vnodes)}, func() ([]VNodeMove, error) {
+		return hc.assignVNodes(name, vnodes)
+	})
+	return err
+}
+
+func (hc *HashRingCluster) assignVNodes(name string, vnodes []int) ([]VNodeMove, error) {
+	if name == "" || len(vnodes) == 0 {
+		return nil, ErrInvalidInput
+	}
+	for _, i := range vnodes {
+		if i < 0 || i >= hc.numberOfVirtualNodes {
+			return nil, ErrInvalidInput
+		}
+	}
+
+	server := hc.findServer(name)
+	if server == nil {
+		server = hc.newServer(name)
 	}
 
+	moves := []VNodeMove{}
+	for _, i := range vnodes {
+		if move := hc.assign(i, server); move.From != move.To {
+			moves = append(moves, move)
+		}
+	}
+	return moves, nil
+}
+
+func (hc *HashRingCluster) newServer(name string) *ServerInfo {
 	server := &ServerInfo{}
 
 	server.name = name
 	server.idx = len(hc.servers)
+	server.weight = 1
 	hc.servers = append(hc.servers, server)
+	return server
+}
+
+// retireServer drops server from the cluster, it must not own virtual nodes.
+func (hc *HashRingCluster) retireServer(server *ServerInfo) {
+	servers := make([]*ServerInfo, 0, len(hc.servers))
+	for _, serverInfo := range hc.servers {
+		if serverInfo != server {
+			serverInfo.idx = len(servers)
+			servers = append(servers, serverInfo)
+		}
+	}
+	hc.servers = servers
+}
 
-	for i := start; i <= end; i++ {
-		if hc.virtualNodes[i].serverInfo != nil {
-			oldServerInfo := hc.virtualNodes[i].serverInfo
-			oldServerInfo.virtualNodes = removeVirtualNode(oldServerInfo.virtualNodes, i)
+// assign hands virtual node i to server, a nil server unassigns it. A
+// migration of the virtual node is cancelled.
+func (hc *HashRingCluster) assign(i int, server *ServerInfo) VNodeMove {
+	delete(hc.migrations, i)
+	vnode := hc.virtualNodes[i]
+	move := VNodeMove{VNode: i}
+	if vnode.serverInfo == server {
+		if server != nil {
+			move.From, move.To = server.name, server.name
 		}
-		hc.virtualNodes[i].serverInfo = server
+		return move
+	}
 
-		server.virtualNodes = append(server.virtualNodes, hc.virtualNodes[i])
-		hc.virtualToServerMapping[hc.virtualNodes[i].name] = server
+	if vnode.serverInfo != nil {
+		oldServerInfo := vnode.serverInfo
+		oldServerInfo.virtualNodes = removeVirtualNode(oldServerInfo.virtualNodes, i)
+		move.From = oldServerInfo.name
 	}
-	return nil
+	vnode.serverInfo = server
+
+	if server != nil {
+		server.virtualNodes = append(server.virtualNodes, vnode)
+		hc.virtualToServerMapping[vnode.name] = server
+		move.To = server.name
+	} else {
+		delete(hc.virtualToServerMapping, vnode.name)
+	}
+	return move
+}
+
+// sortedVNodes returns the indices of the virtual nodes owned by server in
+// ascending order.
+func sortedVNodes(server *ServerInfo) []int {
+	vnodes := make([]int, 0, len(server.virtualNodes))
+	for _, vnode := range server.virtualNodes {
+		vnodes = append(vnodes, vnode.idx)
+	}
+	sort.Ints(vnodes)
+	return vnodes
 }
 
+// RemoveServer drops a server from the cluster. policy decides what happens
+// to its virtual nodes, the returned moves list every virtual node that
+// changed hands.
+func (hc *HashRingCluster) RemoveServer(name string, policy RemovePolicy) ([]VNodeMove, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	return hc.record("remove", []string{name, strconv.Itoa(int(policy.Mode)), policy.Successor}, func() ([]VNodeMove, error) {
+		return hc.removeServer(name, policy)
+	})
+}
+
+func (hc *HashRingCluster) removeServer(name string, policy RemovePolicy) ([]VNodeMove, error) {
+	server := hc.findServer(name)
+	if server == nil {
+		return nil, ErrServerNotFound
+	}
+
+	remaining := make([]*ServerInfo, 0, len(hc.servers))
+	for _, serverInfo := range hc.servers {
+		if serverInfo != server {
+			remaining = append(remaining, serverInfo)
+		}
+	}
+
+	var successor *ServerInfo
+	switch policy.Mode {
+	case RemoveUnassign:
+	case RemoveSpread:
+		if lightestServer(remaining, vnodeCount) == nil && len(server.virtualNodes) > 0 {
+			return nil, ErrNoServers
+		}
+	case RemoveToSuccessor:
+		if policy.Successor == name {
+			return nil, ErrInvalidInput
+		}
+		successor = hc.findServer(policy.Successor)
+		if successor == nil {
+			return nil, ErrServerNotFound
+		}
+	default:
+		return nil, ErrInvalidInput
+	}
+
+	moves := []VNodeMove{}
+	for _, i := range sortedVNodes(server) {
+		target := successor
+		if policy.Mode == RemoveSpread {
+			target = lightestServer(remaining, vnodeCount)
+		}
+		moves = append(moves, hc.assign(i, target))
+	}
+
+	hc.retireServer(server)
+	return moves, nil
+}
+
+func vnodeCount(server *ServerInfo) int {
+	return len(server.virtualNodes)
+}
+
+// lightestServer returns the server that has the fewest virtual nodes for
+// its weight after taking one more, the first one on ties. Servers with
+// weight 0 are skipped, nil is returned if there is no other.
+func lightestServer(servers []*ServerInfo, count func(*ServerInfo) int) *ServerInfo {
+	var lightest *ServerInfo
+	load := 0.0
+	for _, server := range servers {
+		if !(server.weight > 0) {
+			continue
+		}
+		if l := float64(count(server)+1) / server.weight; lightest == nil || l < load {
+			lightest, load = server, l
+		}
+	}
+	return lightest
+}
+
+// Merge moves all virtual nodes of source to target and retires source. It
+// returns the number of virtual nodes that moved.
+func (hc *HashRingCluster) Merge(source string, target string) (int, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	if hc.findServer(source) == nil || hc.findServer(target) == nil {
+		return 0, ErrServerNotFound
+	}
+
+	moves, err := hc.record("merge", []string{source, target}, func() ([]VNodeMove, error) {
+		return hc.removeServer(source, RemovePolicy{Mode: RemoveToSuccessor, Successor: target})
+	})
+	return len(moves), err
+}
+
+// ReplaceServer hands all virtual nodes and the weight of oldName to the new
+// server newName and retires oldName, e.g. to move to a new host. Migrations
+// of the virtual nodes continue from newName, migrations to oldName go to
+// newName instead. Undo brings oldName back as the last server.
+func (hc *HashRingCluster) ReplaceServer(oldName string, newName string) error {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	_, err := hc.record("replace", []string{oldName, newName}, func() ([]VNodeMove, error) {
+		oldServer := hc.findServer(oldName)
+		if oldServer == nil {
+			return nil, ErrServerNotFound
+		}
+		if newName == "" {
+			return nil, ErrInvalidInput
+		}
+		if hc.findServer(newName) != nil {
+			return nil, ErrServerExists
+		}
+
+		newServer := hc.newServer(newName)
+		newServer.weight = oldServer.weight
+		moves := []VNodeMove{}
+		for _, i := range sortedVNodes(oldServer) {
+			target, migrating := hc.migrations[i]
+			moves = append(moves, hc.assign(i, newServer))
+			if migrating && target != newName {
+				hc.migrations[i] = target
+			}
+		}
+		for i, target := range hc.migrations {
+			if target == oldName {
+				hc.migrations[i] = newName
+			}
+		}
+		hc.retireServer(oldServer)
+		return moves, nil
+	})
+	return err
+}
+
+// SetUnassignedPolicy sets how lookups treat virtual nodes without a
+// server and journals the change. The default is UnassignedError.
+func (hc *HashRingCluster) SetUnassignedPolicy(policy UnassignedPolicy) error {
+	if !validPolicy(policy) {
+		return ErrInvalidInput
+	}
+
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+	_, err := hc.record("policy", []string{strconv.Itoa(int(policy.Mode)), policy.Server}, func() ([]VNodeMove, error) {
+		hc.unassignedPolicy = policy
+		return nil, nil
+	})
+	return err
+}
+
+func validPolicy(policy UnassignedPolicy) bool {
+	switch policy.Mode {
+	case UnassignedError, UnassignedNextAssigned:
+		return true
+	case UnassignedDefault:
+		return policy.Server != ""
+	}
+	return false
+}
+
+// GetServer returns the server of key, or BlackHole if there is none.
+// Prefer GetServerE, which can tell the two apart.
 func (hc *HashRingCluster) GetServer(key string) string {
+	server, err := hc.GetServerE(key)
+	if err != nil {
+		return BlackHole
+	}
+	return server
+}
+
+// GetServerE returns the server of key. Keys landing on a virtual node
+// without a server are handled by the UnassignedPolicy of the cluster.
+// While the virtual node migrates this is still its owner, see GetRoute.
+func (hc *HashRingCluster) GetServerE(key string) (string, error) {
+	route, err := hc.GetRoute(key)
+	if err != nil {
+		return "", err
+	}
+	return route.Server, nil
+}
+
+// GetServers returns n distinct servers for key, walking the virtual node
+// ring clockwise and skipping virtual nodes without a server or with a
+// server that was already picked. The first server is the one GetServerE
+// returns when the virtual node of key is assigned.
+func (hc *HashRingCluster) GetServers(key string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, ErrInvalidInput
+	}
+
+	view := hc.loadView()
+	seen := make(map[string]bool, n)
+	servers := make([]string, 0, n)
+	view.walkVNodes(key, func(vnode int) bool {
+		server := view.owners[vnode]
+		if server != "" && !seen[server] {
+			seen[server] = true
+			servers = append(servers, server)
+		}
+		return len(servers) < n
+	})
 
-	virtualNodeName, _ := hc.ring.GetNode(key)
-	serverInfo, ok := hc.virtualToServerMapping[virtualNodeName]
-	if !ok {
-		return "BlackHole"
+	if len(servers) < n {
+		return nil, ErrNotEnoughServers
 	}
-	return serverInfo.name
+	return servers, nil
 }
 
+// SetServerWeight sets the capacity weight of a server and journals the
+// change. Weights only take effect on the next Rebalance, a server with
+// weight 0 gets no virtual nodes.
+func (hc *HashRingCluster) SetServerWeight(name string, weight float64) error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if !validWeight(weight) {
+		return ErrInvalidInput
+	}
+	_, err := hc.record("weight", []string{name, strconv.FormatFloat(weight, 'g', -1, 64)}, func() ([]VNodeMove, error) {
+		serverInfo := hc.findServer(name)
+		if serverInfo == nil {
+			return nil, ErrServerNotFound
+		}
+		serverInfo.weight = weight
+		return nil, nil
+	})
+	return err
+}
+
+// validWeight reports whether weight is a finite weight of at least 0.
+func validWeight(weight float64) bool {
+	return weight >= 0 && !math.IsInf(weight, 1)
+}
+
+// GetServerInfo returns a copy of the server serverName, or nil if there is
+// none. Later changes of the cluster do not affect it.
 func (hc *HashRingCluster) GetServerInfo(serverName string) *ServerInfo {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	serverInfo := hc.findServer(serverName)
+	if serverInfo == nil {
+		return nil
+	}
+	return serverInfo.snapshot()
+}
+
+// snapshot returns a copy of the server with copies of its virtual nodes,
+// hc.mu must be held.
+func (s *ServerInfo) snapshot() *ServerInfo {
+	server := &ServerInfo{name: s.name, idx: s.idx, weight: s.weight}
+	server.virtualNodes = make([]*VirtualNodeInfo, len(s.virtualNodes))
+	for i, vnode := range s.virtualNodes {
+		server.virtualNodes[i] = &VirtualNodeInfo{name: vnode.name, idx: vnode.idx, serverInfo: server}
+	}
+	return server
+}
+
+func (hc *HashRingCluster) findServer(serverName string) *ServerInfo {
 	for _, serverInfo := range hc.servers {
 		if serverInfo.name == serverName {
 			return serverInfo
@@ -127,18 +626,97 @@ func (hc *HashRingCluster) GetServerInfo(serverName string) *ServerInfo {
 	return nil
 }
 
+// Split hands the upper half of the virtual nodes of serverName to the new
+// server newServerName.
 func (hc *HashRingCluster) Split(serverName string, newServerName string) error {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	_, err := hc.splitFraction(serverName, newServerName, 0.5)
+	return err
+}
 
-	serverInfo := hc.GetServerInfo(serverName)
+// SplitFraction hands fraction of the virtual nodes of serverName, the ones
+// with the highest indices, to the new server newServerName.
+func (hc *HashRingCluster) SplitFraction(serverName string, newServerName string, fraction float64) ([]VNodeMove, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+	return hc.splitFraction(serverName, newServerName, fraction)
+}
 
+func (hc *HashRingCluster) splitFraction(serverName string, newServerName string, fraction float64) ([]VNodeMove, error) {
+	if !(fraction > 0 && fraction < 1) {
+		return nil, ErrInvalidInput
+	}
+
+	serverInfo := hc.findServer(serverName)
 	if serverInfo == nil {
-		return errors.New("SERVERNOTFOUND")
+		return nil, ErrServerNotFound
 	}
+
+	// Round the moved part, 1-fraction is inexact e.g. for 0.9
 	numVNodes := len(serverInfo.virtualNodes)
+	keep := numVNodes - int(math.Round(float64(numVNodes)*fraction))
+	args := []string{serverName, newServerName, strconv.FormatFloat(fraction, 'g', -1, 64)}
+	return hc.record("split", args, func() ([]VNodeMove, error) {
+		return hc.split(serverInfo, []string{newServerName}, []int{0, keep, numVNodes})
+	})
+}
 
-	halfVNodes := int(numVNodes / 2)
+// SplitN divides the virtual nodes of serverName into len(newServerNames)+1
+// contiguous parts of equal size. serverName keeps the first part and each
+// new server gets one of the others.
+func (hc *HashRingCluster) SplitN(serverName string, newServerNames ...string) ([]VNodeMove, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
 
-	// AddServer is an overwrite with cleanup
-	hc.AddServer(newServerName, fmt.Sprintf("%d-%d", halfVNodes, numVNodes-1))
-	return nil
+	if len(newServerNames) == 0 {
+		return nil, ErrInvalidInput
+	}
+
+	serverInfo := hc.findServer(serverName)
+	if serverInfo == nil {
+		return nil, ErrServerNotFound
+	}
+
+	numVNodes := len(serverInfo.virtualNodes)
+	parts := len(newServerNames) + 1
+	bounds := make([]int, parts+1)
+	for i := range bounds {
+		bounds[i] = i * numVNodes / parts
+	}
+	return hc.record("splitn", append([]string{serverName}, newServerNames...), func() ([]VNodeMove, error) {
+		return hc.split(serverInfo, newServerNames, bounds)
+	})
+}
+
+// split hands the sorted virtual nodes of serverInfo in bounds[i+1]..bounds[i+2]
+// to newServerNames[i]. Every part must hold at least one virtual node.
+func (hc *HashRingCluster) split(serverInfo *ServerInfo, newServerNames []string, bounds []int) ([]VNodeMove, error) {
+	seen := map[string]bool{serverInfo.name: true}
+	for _, name := range newServerNames {
+		if name == "" {
+			return nil, ErrInvalidInput
+		}
+		if seen[name] || hc.findServer(name) != nil {
+			return nil, ErrServerExists
+		}
+		seen[name] = true
+	}
+
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return nil, ErrInvalidInput
+		}
+	}
+
+	vnodes := sortedVNodes(serverInfo)
+	moves := []VNodeMove{}
+	for i, name := range newServerNames {
+		server := hc.newServer(name)
+		for _, vnode := range vnodes[bounds[i+1]:bounds[i+2]] {
+			moves = append(moves, hc.assign(vnode, server))
+		}
+	}
+	return moves, nil
 }
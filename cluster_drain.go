@@ -0,0 +1,172 @@
+package hashring
+
+import (
+	"context"
+	"sort"
+)
+
+// DrainOptions configures Drain.
+type DrainOptions struct {
+	// BatchSize is the number of virtual nodes moved at once, default 1.
+	BatchSize int
+	// Ack is called for every batch while it migrates and should return
+	// once the data of the batch has been copied. Ownership only changes
+	// after it returns nil, an error stops the drain and aborts the batch.
+	// It is required.
+	Ack func(ctx context.Context, batch []VNodeMove) error
+	// OnProgress is called after every committed batch.
+	OnProgress func(DrainProgress)
+}
+
+// DrainProgress reports the progress of Drain.
+type DrainProgress struct {
+	Server string
+	Batch  []VNodeMove
+	// Moved counts the virtual nodes moved so far, Remaining the ones the
+	// server still owns.
+	Moved     int
+	Remaining int
+}
+
+// Drain moves the virtual nodes of server off in batches and retires it
+// once it owns none. Every virtual node goes to the remaining server with
+// the fewest virtual nodes for its weight, servers with weight 0 get none.
+// Batches move through BeginMigration, Ack and CommitMigration, so lookups
+// see the target as fallback while a batch migrates. The cluster is not
+// locked while Ack runs. If Drain stops early, on an error or when
+// ctx is done, the committed batches stay moved.
+func (hc *HashRingCluster) Drain(ctx context.Context, server string, options DrainOptions) error {
+	if options.Ack == nil {
+		return ErrInvalidInput
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	moved := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, done, err := hc.beginDrainBatch(server, batchSize)
+		if err != nil || done {
+			return err
+		}
+
+		if err := options.Ack(ctx, batch); err != nil {
+			hc.abortDrainBatch(batch)
+			return err
+		}
+
+		moves, remaining, err := hc.commitDrainBatch(server, batch)
+		if err != nil {
+			return err
+		}
+		moved += len(moves)
+		if options.OnProgress != nil {
+			options.OnProgress(DrainProgress{Server: server, Batch: moves, Moved: moved, Remaining: remaining})
+		}
+	}
+}
+
+// beginDrainBatch starts migrating the next batch of virtual nodes of
+// server. Once server owns none it is retired and done is true.
+func (hc *HashRingCluster) beginDrainBatch(server string, batchSize int) (batch []VNodeMove, done bool, err error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	serverInfo := hc.findServer(server)
+	if serverInfo == nil {
+		return nil, false, ErrServerNotFound
+	}
+	if len(serverInfo.virtualNodes) == 0 {
+		_, err := hc.record("drain", []string{server}, func() ([]VNodeMove, error) {
+			return hc.removeServer(server, RemovePolicy{Mode: RemoveUnassign})
+		})
+		return nil, true, err
+	}
+
+	remaining := make([]*ServerInfo, 0, len(hc.servers))
+	counts := map[*ServerInfo]int{}
+	for _, s := range hc.servers {
+		if s != serverInfo {
+			remaining = append(remaining, s)
+			counts[s] = len(s.virtualNodes)
+		}
+	}
+	count := func(s *ServerInfo) int {
+		return counts[s]
+	}
+	if lightestServer(remaining, count) == nil {
+		return nil, false, ErrNoServers
+	}
+
+	vnodes := sortedVNodes(serverInfo)
+	for _, i := range vnodes {
+		if len(batch) == batchSize {
+			break
+		}
+		if _, ok := hc.migrations[i]; ok {
+			continue
+		}
+		target := lightestServer(remaining, count)
+		counts[target]++
+		batch = append(batch, VNodeMove{VNode: i, From: server, To: target.name})
+	}
+	if len(batch) == 0 {
+		// Everything left is migrating elsewhere already
+		return nil, false, ErrMigrationInProgress
+	}
+
+	if hc.migrations == nil {
+		hc.migrations = map[int]string{}
+	}
+	for _, move := range batch {
+		hc.migrations[move.VNode] = move.To
+	}
+	hc.generation++
+	return batch, false, nil
+}
+
+// commitDrainBatch commits the migrations of batch that are still pending,
+// changes made while the batch migrated may have cancelled some.
+func (hc *HashRingCluster) commitDrainBatch(server string, batch []VNodeMove) ([]VNodeMove, int, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	vnodes := []int{}
+	for _, move := range batch {
+		if target, ok := hc.migrations[move.VNode]; ok && target == move.To {
+			vnodes = append(vnodes, move.VNode)
+		}
+	}
+	sort.Ints(vnodes)
+
+	moves := []VNodeMove{}
+	if len(vnodes) > 0 {
+		var err error
+		if moves, err = hc.commitMigration(vnodes); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	remaining := 0
+	if serverInfo := hc.findServer(server); serverInfo != nil {
+		remaining = len(serverInfo.virtualNodes)
+	}
+	return moves, remaining, nil
+}
+
+func (hc *HashRingCluster) abortDrainBatch(batch []VNodeMove) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	for _, move := range batch {
+		if target, ok := hc.migrations[move.VNode]; ok && target == move.To {
+			delete(hc.migrations, move.VNode)
+		}
+	}
+	hc.generation++
+}
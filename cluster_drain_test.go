@@ -0,0 +1,138 @@
+package hashring
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func ackAll(ctx context.Context, batch []VNodeMove) error {
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	cluster := NewHashRingCluster(30)
+	cluster.AddServer("server1", "0-9")
+	cluster.AddServer("server2", "10-19")
+	cluster.AddServer("server3", "20-29")
+	key := keyOfVNode(cluster, 0)
+
+	batches := 0
+	progress := []DrainProgress{}
+	err := cluster.Drain(context.Background(), "server1", DrainOptions{
+		BatchSize: 4,
+		Ack: func(ctx context.Context, batch []VNodeMove) error {
+			if batches == 0 {
+				route, _ := cluster.GetRoute(key)
+				if route.Server != "server1" || route.Fallback != batch[0].To {
+					t.Errorf("Unexpected route while migrating %v", route)
+				}
+			}
+			batches++
+			return nil
+		},
+		OnProgress: func(p DrainProgress) {
+			progress = append(progress, p)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+
+	if batches != 3 || len(progress) != 3 {
+		t.Errorf("Expected 3 batches, got %d %d", batches, len(progress))
+	}
+	if last := progress[len(progress)-1]; last.Moved != 10 || last.Remaining != 0 || len(last.Batch) != 2 {
+		t.Errorf("Unexpected progress %v", last)
+	}
+	if cluster.findServer("server1") != nil {
+		t.Errorf("server1 not retired")
+	}
+	expectVNodeCount(t, cluster, "server2", 15)
+	expectVNodeCount(t, cluster, "server3", 15)
+	expectProblems(t, cluster, 0)
+}
+
+func TestDrainAckError(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+	cluster.AddServer("server2", "5-9")
+	failed := errors.New("copy failed")
+
+	batches := 0
+	err := cluster.Drain(context.Background(), "server1", DrainOptions{
+		BatchSize: 2,
+		Ack: func(ctx context.Context, batch []VNodeMove) error {
+			batches++
+			if batches == 2 {
+				return failed
+			}
+			return nil
+		},
+	})
+	if err != failed {
+		t.Errorf("Expected the Ack error, got %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 3)
+	for i := 0; i < 10; i++ {
+		if _, ok := cluster.MigrationTarget(i); ok {
+			t.Errorf("Migration of %d not aborted", i)
+		}
+	}
+}
+
+func TestDrainCancel(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+	cluster.AddServer("server2", "5-9")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cluster.Drain(ctx, "server1", DrainOptions{
+		Ack: ackAll,
+		OnProgress: func(p DrainProgress) {
+			cancel()
+		},
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 4)
+}
+
+func TestDrainErrors(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+
+	if err := cluster.Drain(context.Background(), "server1", DrainOptions{}); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput without Ack, got %v", err)
+	}
+	if err := cluster.Drain(context.Background(), "server2", DrainOptions{Ack: ackAll}); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound, got %v", err)
+	}
+	if err := cluster.Drain(context.Background(), "server1", DrainOptions{Ack: ackAll}); err != ErrNoServers {
+		t.Errorf("Expected ErrNoServers, got %v", err)
+	}
+}
+
+func TestDrainWeights(t *testing.T) {
+	cluster := NewHashRingCluster(30)
+	cluster.AddServer("server1", "0-11")
+	cluster.AddServer("server2", "12-20")
+	cluster.AddServer("server3", "21-29")
+	cluster.AddServer("server4", "21")
+	cluster.SetServerWeight("server3", 2)
+	cluster.SetServerWeight("server4", 0)
+
+	if err := cluster.Drain(context.Background(), "server1", DrainOptions{BatchSize: 5, Ack: ackAll}); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	expectVNodeCount(t, cluster, "server2", 10)
+	expectVNodeCount(t, cluster, "server3", 19)
+	expectVNodeCount(t, cluster, "server4", 1)
+
+	cluster.SetServerWeight("server2", 0)
+	cluster.SetServerWeight("server3", 0)
+	if err := cluster.Drain(context.Background(), "server4", DrainOptions{Ack: ackAll}); err != ErrNoServers {
+		t.Errorf("Expected ErrNoServers without weighted servers, got %v", err)
+	}
+}
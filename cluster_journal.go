@@ -0,0 +1,505 @@
+package hashring
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNothingToUndo   = errors.New("NOTHINGTOUNDO")
+	ErrNothingToRedo   = errors.New("NOTHINGTOREDO")
+	ErrJournalConflict = errors.New("JOURNALCONFLICT")
+)
+
+// JournalEntry records one change of a HashRingCluster. Applying Created,
+// Weights, Policy, Moves and Retired in that order to the state before the
+// change gives the state after it, undo and redo entries are recorded the
+// same way.
+type JournalEntry struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor,omitempty"`
+	Op      string    `json:"op"`
+	Args    []string  `json:"args,omitempty"`
+	Created []string  `json:"created,omitempty"`
+	Retired []string  `json:"retired,omitempty"`
+	// Weights holds the weight changes, created servers start and retired
+	// servers end with weight 1.
+	Weights []WeightChange `json:"weights,omitempty"`
+	// Policy is set if the UnassignedPolicy changed.
+	Policy *PolicyChange `json:"policy,omitempty"`
+	Moves  []VNodeMove   `json:"moves"`
+	// Resize is set for changes of the number of virtual nodes, which carry
+	// no other changes.
+	Resize *JournalResize `json:"resize,omitempty"`
+}
+
+// WeightChange records a change of the weight of a server.
+type WeightChange struct {
+	Server string  `json:"server"`
+	From   float64 `json:"from"`
+	To     float64 `json:"to"`
+}
+
+// PolicyChange records a change of the UnassignedPolicy.
+type PolicyChange struct {
+	From UnassignedPolicy `json:"from"`
+	To   UnassignedPolicy `json:"to"`
+}
+
+// JournalResize records a change of the number of virtual nodes with the
+// owners of every virtual node before and after it, "" for none.
+type JournalResize struct {
+	From   int      `json:"from"`
+	To     int      `json:"to"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+type clusterJournal struct {
+	entries []JournalEntry
+	undo    []int
+	redo    []int
+	actor   string
+	writer  io.Writer
+	// writeErr is the first error writing to writer, no entries are written
+	// after it.
+	writeErr error
+	// limit is the number of entries kept, 0 for all. base counts the
+	// entries dropped before entries[0].
+	limit int
+	base  int
+}
+
+// SetActor sets the actor recorded with the following journal entries.
+func (hc *HashRingCluster) SetActor(actor string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.journal.actor = actor
+}
+
+// SetJournalWriter appends every following journal entry to w as a line of
+// JSON, see ReadJournal. If writing an entry fails no further entries are
+// written, so w never has gaps, see JournalErr.
+func (hc *HashRingCluster) SetJournalWriter(w io.Writer) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.journal.writer = w
+	hc.journal.writeErr = nil
+}
+
+// JournalErr returns the error that stopped writing journal entries to the
+// writer set by SetJournalWriter, or nil. The changes themselves were made,
+// the entries missing from the writer are still in Journal.
+func (hc *HashRingCluster) JournalErr() error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	return hc.journal.writeErr
+}
+
+// SetJournalLimit keeps only the latest limit journal entries, 0 keeps all
+// of them. Older entries are dropped together with the changes Undo and Redo
+// could still reach through them. The journal writer still gets every
+// entry, Replay needs them all.
+func (hc *HashRingCluster) SetJournalLimit(limit int) error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if limit < 0 {
+		return ErrInvalidInput
+	}
+	hc.journal.limit = limit
+	hc.journal.trim()
+	return nil
+}
+
+// trim drops the entries beyond the limit and the undo and redo steps that
+// refer to them.
+func (j *clusterJournal) trim() {
+	if j.limit == 0 || len(j.entries) <= j.limit {
+		return
+	}
+	drop := len(j.entries) - j.limit
+	j.entries = j.entries[drop:]
+	j.base += drop
+
+	keep := func(seqs []int) []int {
+		kept := []int{}
+		for _, seq := range seqs {
+			if seq > j.base {
+				kept = append(kept, seq)
+			}
+		}
+		return kept
+	}
+	j.undo = keep(j.undo)
+	j.redo = keep(j.redo)
+}
+
+// entry returns the entry with sequence number seq, which must be kept.
+func (j *clusterJournal) entry(seq int) JournalEntry {
+	return j.entries[seq-1-j.base]
+}
+
+// Journal returns the entries recorded so far, without the ones dropped by
+// SetJournalLimit.
+func (hc *HashRingCluster) Journal() []JournalEntry {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	entries := make([]JournalEntry, len(hc.journal.entries))
+	copy(entries, hc.journal.entries)
+	return entries
+}
+
+func (hc *HashRingCluster) serverNames() []string {
+	names := make([]string, len(hc.servers))
+	for i, server := range hc.servers {
+		names[i] = server.name
+	}
+	return names
+}
+
+// diffNames returns the names in b that are not in a.
+func diffNames(a []string, b []string) []string {
+	known := make(map[string]bool, len(a))
+	for _, name := range a {
+		known[name] = true
+	}
+	diff := []string{}
+	for _, name := range b {
+		if !known[name] {
+			diff = append(diff, name)
+		}
+	}
+	return diff
+}
+
+func (hc *HashRingCluster) serverWeights() map[string]float64 {
+	weights := make(map[string]float64, len(hc.servers))
+	for _, server := range hc.servers {
+		weights[server.name] = server.weight
+	}
+	return weights
+}
+
+// weightChanges returns the changes from the weights before to the weights
+// after of the named servers, servers that do not exist have weight 1.
+func weightChanges(names []string, before map[string]float64, after map[string]float64) []WeightChange {
+	var changes []WeightChange
+	for _, name := range names {
+		from, ok := before[name]
+		if !ok {
+			from = 1
+		}
+		to, ok := after[name]
+		if !ok {
+			to = 1
+		}
+		if from != to {
+			changes = append(changes, WeightChange{Server: name, From: from, To: to})
+		}
+	}
+	return changes
+}
+
+// record runs the change fn and journals the moves, the servers it created
+// and retired and the weights and policy it changed. Failed changes are not
+// journaled.
+func (hc *HashRingCluster) record(op string, args []string, fn func() ([]VNodeMove, error)) ([]VNodeMove, error) {
+	before := hc.serverNames()
+	beforeWeights := hc.serverWeights()
+	beforePolicy := hc.unassignedPolicy
+	moves, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	after := hc.serverNames()
+	retired := diffNames(after, before)
+
+	entry := JournalEntry{
+		Op:      op,
+		Args:    args,
+		Created: diffNames(before, after),
+		Retired: retired,
+		Weights: weightChanges(append(after, retired...), beforeWeights, hc.serverWeights()),
+		Moves:   moves,
+	}
+	if hc.unassignedPolicy != beforePolicy {
+		entry.Policy = &PolicyChange{From: beforePolicy, To: hc.unassignedPolicy}
+	}
+	hc.journalChange(entry)
+	return moves, nil
+}
+
+// journalChange journals a new change, which can be undone and drops the
+// changes that could be redone.
+func (hc *HashRingCluster) journalChange(entry JournalEntry) {
+	entry = hc.appendEntry(entry)
+	hc.journal.undo = append(hc.journal.undo, entry.Seq)
+	hc.journal.redo = nil
+}
+
+func (hc *HashRingCluster) appendEntry(entry JournalEntry) JournalEntry {
+	entry.Seq = hc.journal.base + len(hc.journal.entries) + 1
+	entry.Time = time.Now().UTC()
+	entry.Actor = hc.journal.actor
+	if entry.Moves == nil {
+		entry.Moves = []VNodeMove{}
+	}
+	hc.journal.entries = append(hc.journal.entries, entry)
+	hc.journal.trim()
+	hc.generation++
+
+	if hc.journal.writer != nil && hc.journal.writeErr == nil {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			_, err = hc.journal.writer.Write(append(data, '\n'))
+		}
+		hc.journal.writeErr = err
+	}
+	return entry
+}
+
+// invert returns the entry that reverts entry.
+func invert(entry JournalEntry) JournalEntry {
+	if r := entry.Resize; r != nil {
+		return JournalEntry{Resize: &JournalResize{From: r.To, To: r.From, Before: r.After, After: r.Before}}
+	}
+
+	var weights []WeightChange
+	for i := len(entry.Weights) - 1; i >= 0; i-- {
+		change := entry.Weights[i]
+		weights = append(weights, WeightChange{Server: change.Server, From: change.To, To: change.From})
+	}
+	moves := make([]VNodeMove, len(entry.Moves))
+	for i, move := range entry.Moves {
+		moves[len(moves)-1-i] = VNodeMove{VNode: move.VNode, From: move.To, To: move.From}
+	}
+	inverse := JournalEntry{Created: entry.Retired, Retired: entry.Created, Weights: weights, Moves: moves}
+	if p := entry.Policy; p != nil {
+		inverse.Policy = &PolicyChange{From: p.To, To: p.From}
+	}
+	return inverse
+}
+
+// apply replays the changes of entry. Nothing changes if the current state
+// does not match the state the entry was recorded in.
+func (hc *HashRingCluster) apply(entry JournalEntry) error {
+	if entry.Resize != nil {
+		return hc.applyResize(entry.Resize)
+	}
+
+	for _, name := range entry.Created {
+		if hc.findServer(name) != nil {
+			return ErrJournalConflict
+		}
+	}
+
+	if p := entry.Policy; p != nil && (p.From != hc.unassignedPolicy || !validPolicy(p.To)) {
+		return ErrJournalConflict
+	}
+
+	// Weights after the servers are created, track them through the changes
+	weights := map[string]float64{}
+	for _, name := range entry.Created {
+		weights[name] = 1
+	}
+	for _, change := range entry.Weights {
+		weight, ok := weights[change.Server]
+		if !ok {
+			serverInfo := hc.findServer(change.Server)
+			if serverInfo == nil {
+				return ErrJournalConflict
+			}
+			weight = serverInfo.weight
+		}
+		if weight != change.From || !validWeight(change.To) {
+			return ErrJournalConflict
+		}
+		weights[change.Server] = change.To
+	}
+
+	// Owners after the servers are created, track them through the moves
+	owners := map[int]string{}
+	owner := func(i int) string {
+		if name, ok := owners[i]; ok {
+			return name
+		}
+		if serverInfo := hc.virtualNodes[i].serverInfo; serverInfo != nil {
+			return serverInfo.name
+		}
+		return ""
+	}
+	exists := func(name string) bool {
+		return name == "" || hc.findServer(name) != nil || contains(entry.Created, name)
+	}
+	for _, move := range entry.Moves {
+		if move.VNode < 0 || move.VNode >= hc.numberOfVirtualNodes || owner(move.VNode) != move.From || !exists(move.To) {
+			return ErrJournalConflict
+		}
+		owners[move.VNode] = move.To
+	}
+	for _, name := range entry.Retired {
+		serverInfo := hc.findServer(name)
+		if serverInfo == nil {
+			return ErrJournalConflict
+		}
+		for _, vnode := range serverInfo.virtualNodes {
+			if owner(vnode.idx) == name {
+				return ErrJournalConflict
+			}
+		}
+		for _, o := range owners {
+			if o == name {
+				return ErrJournalConflict
+			}
+		}
+	}
+
+	for _, name := range entry.Created {
+		hc.newServer(name)
+	}
+	for _, change := range entry.Weights {
+		hc.findServer(change.Server).weight = change.To
+	}
+	if entry.Policy != nil {
+		hc.unassignedPolicy = entry.Policy.To
+	}
+	for _, move := range entry.Moves {
+		hc.assign(move.VNode, hc.findServer(move.To))
+	}
+	for _, name := range entry.Retired {
+		hc.retireServer(hc.findServer(name))
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Undo reverts the latest change that has not been undone yet and journals
+// the revert.
+func (hc *HashRingCluster) Undo() (JournalEntry, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	if len(hc.journal.undo) == 0 {
+		return JournalEntry{}, ErrNothingToUndo
+	}
+	seq := hc.journal.undo[len(hc.journal.undo)-1]
+
+	entry := invert(hc.journal.entry(seq))
+	if err := hc.apply(entry); err != nil {
+		return JournalEntry{}, err
+	}
+	entry.Op = "undo"
+	entry.Args = []string{strconv.Itoa(seq)}
+
+	hc.journal.undo = hc.journal.undo[:len(hc.journal.undo)-1]
+	hc.journal.redo = append(hc.journal.redo, seq)
+	return hc.appendEntry(entry), nil
+}
+
+// Redo applies the latest undone change again and journals it.
+func (hc *HashRingCluster) Redo() (JournalEntry, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	if len(hc.journal.redo) == 0 {
+		return JournalEntry{}, ErrNothingToRedo
+	}
+	seq := hc.journal.redo[len(hc.journal.redo)-1]
+
+	original := hc.journal.entry(seq)
+	entry := JournalEntry{Created: original.Created, Retired: original.Retired, Weights: original.Weights, Policy: original.Policy, Moves: original.Moves, Resize: original.Resize}
+	if err := hc.apply(entry); err != nil {
+		return JournalEntry{}, err
+	}
+	entry.Op = "redo"
+	entry.Args = []string{strconv.Itoa(seq)}
+
+	hc.journal.redo = hc.journal.redo[:len(hc.journal.redo)-1]
+	hc.journal.undo = append(hc.journal.undo, seq)
+	return hc.appendEntry(entry), nil
+}
+
+// Replay applies journal entries, e.g. from ReadJournal, to the cluster and
+// takes them over as its journal. The entries must start from the current
+// state of the cluster, usually a new or loaded one. Either all entries are
+// applied or the cluster is left unchanged.
+func (hc *HashRingCluster) Replay(entries []JournalEntry) error {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	cluster, err := newClusterFromState(hc.state())
+	if err != nil {
+		return err
+	}
+
+	undo, redo := []int{}, []int{}
+	for i, entry := range entries {
+		if entry.Seq != i+1 {
+			return ErrJournalConflict
+		}
+		if err := cluster.apply(entry); err != nil {
+			return err
+		}
+
+		switch entry.Op {
+		case "undo", "redo":
+			from, to := &undo, &redo
+			if entry.Op == "redo" {
+				from, to = &redo, &undo
+			}
+			if len(*from) == 0 {
+				return ErrJournalConflict
+			}
+			*to = append(*to, (*from)[len(*from)-1])
+			*from = (*from)[:len(*from)-1]
+		default:
+			undo = append(undo, entry.Seq)
+			redo = redo[:0]
+		}
+	}
+
+	hc.restore(cluster)
+	hc.journal.entries = make([]JournalEntry, len(entries))
+	copy(hc.journal.entries, entries)
+	hc.journal.undo = undo
+	hc.journal.redo = redo
+	hc.journal.base = 0
+	hc.journal.trim()
+	return nil
+}
+
+// ReadJournal reads entries written through SetJournalWriter.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
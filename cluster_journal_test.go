@@ -0,0 +1,295 @@
+package hashring
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func owners(cluster *HashRingCluster) []string {
+	result := make([]string, cluster.numberOfVirtualNodes)
+	for i, vnode := range cluster.virtualNodes {
+		if vnode.serverInfo != nil {
+			result[i] = vnode.serverInfo.name
+		}
+	}
+	return result
+}
+
+func expectOwners(t *testing.T, cluster *HashRingCluster, expected []string) {
+	actual := owners(cluster)
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Virtual node %d expected owner %q but got %q", i, expected[i], actual[i])
+		}
+	}
+	for _, server := range cluster.servers {
+		count := 0
+		for _, owner := range expected {
+			if owner == server.name {
+				count++
+			}
+		}
+		expectVNodeCount(t, cluster, server.name, count)
+	}
+}
+
+func TestJournalRecordsChanges(t *testing.T) {
+	cluster := NewHashRingCluster(20)
+	cluster.SetActor("alice")
+	cluster.AddServer("server1", "0-19")
+	cluster.Split("server1", "server2")
+	cluster.AddServer("server3", "200-300")
+
+	journal := cluster.Journal()
+	if len(journal) != 2 {
+		t.Fatalf("Expected 2 entries but got %d", len(journal))
+	}
+
+	split := journal[1]
+	if split.Seq != 2 || split.Op != "split" || split.Actor != "alice" || split.Time.IsZero() {
+		t.Errorf("Unexpected entry %+v", split)
+	}
+	if len(split.Created) != 1 || split.Created[0] != "server2" {
+		t.Errorf("Split should create server2 %v", split.Created)
+	}
+	if len(split.Moves) != 10 || split.Moves[0] != (VNodeMove{VNode: 10, From: "server1", To: "server2"}) {
+		t.Errorf("Unexpected moves %v", split.Moves)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	cluster := NewHashRingCluster(30)
+	cluster.AddServer("server1", "0-14")
+	cluster.AddServer("server2", "15-29")
+	before := owners(cluster)
+
+	cluster.SplitN("server1", "server1a", "server1b")
+	cluster.Merge("server2", "server1")
+	after := owners(cluster)
+
+	if _, err := cluster.Undo(); err != nil {
+		t.Fatalf("Undo failed %v", err)
+	}
+	if cluster.GetServerInfo("server2") == nil {
+		t.Fatal("Undo of merge did not restore server2")
+	}
+	if _, err := cluster.Undo(); err != nil {
+		t.Fatalf("Undo failed %v", err)
+	}
+	expectOwners(t, cluster, before)
+	if cluster.GetServerInfo("server1a") != nil || len(cluster.servers) != 2 {
+		t.Error("Undo of split left the new servers")
+	}
+
+	if _, err := cluster.Redo(); err != nil {
+		t.Fatalf("Redo failed %v", err)
+	}
+	if _, err := cluster.Redo(); err != nil {
+		t.Fatalf("Redo failed %v", err)
+	}
+	expectOwners(t, cluster, after)
+
+	if _, err := cluster.Redo(); err != ErrNothingToRedo {
+		t.Errorf("Expected ErrNothingToRedo but got %v", err)
+	}
+
+	entries := cluster.Journal()
+	if len(entries) != 8 || entries[4].Op != "undo" || entries[4].Args[0] != "4" || entries[7].Op != "redo" {
+		t.Errorf("Unexpected journal %+v", entries)
+	}
+}
+
+func TestUndoClearsRedoOnNewChange(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+	cluster.Split("server1", "server2")
+	cluster.Undo()
+	cluster.AddServer("server3", "0-1")
+
+	if _, err := cluster.Redo(); err != ErrNothingToRedo {
+		t.Errorf("Expected ErrNothingToRedo but got %v", err)
+	}
+	cluster.Undo()
+	cluster.Undo()
+	if _, err := cluster.Undo(); err != ErrNothingToUndo {
+		t.Errorf("Expected ErrNothingToUndo but got %v", err)
+	}
+	if len(cluster.servers) != 0 {
+		t.Errorf("Expected no servers after undoing everything but got %d", len(cluster.servers))
+	}
+}
+
+func TestReplayJournal(t *testing.T) {
+	var buf bytes.Buffer
+	cluster := NewHashRingCluster(40)
+	cluster.SetJournalWriter(&buf)
+	cluster.AddServer("server1", "0-19")
+	cluster.AddServer("server2", "20-39")
+	cluster.SplitFraction("server2", "server3", 0.25)
+	cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveSpread})
+	cluster.Undo()
+	cluster.Undo()
+	cluster.Redo()
+
+	entries, err := ReadJournal(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read journal %v", err)
+	}
+	if len(entries) != 7 {
+		t.Fatalf("Expected 7 entries but got %d", len(entries))
+	}
+
+	replayed := NewHashRingCluster(40)
+	if err := replayed.Replay(entries); err != nil {
+		t.Fatalf("Replay failed %v", err)
+	}
+	expectOwners(t, replayed, owners(cluster))
+
+	// The undo history is rebuilt too
+	cluster.Undo()
+	replayed.Undo()
+	expectOwners(t, replayed, owners(cluster))
+}
+
+func TestReplayConflict(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+	cluster.Split("server1", "server2")
+
+	other := NewHashRingCluster(10)
+	other.AddServer("server9", "0-9")
+	before := owners(other)
+
+	if err := other.Replay(cluster.Journal()); err != ErrJournalConflict {
+		t.Errorf("Expected ErrJournalConflict but got %v", err)
+	}
+	expectOwners(t, other, before)
+}
+
+// failingWriter accepts n writes and fails the following ones.
+type failingWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return w.buf.Write(p)
+}
+
+func TestJournalWriteError(t *testing.T) {
+	w := &failingWriter{n: 1}
+	cluster := NewHashRingCluster(10)
+	cluster.SetJournalWriter(w)
+	cluster.AddServer("server1", "0-9")
+	if err := cluster.JournalErr(); err != nil {
+		t.Fatalf("Unexpected journal error %v", err)
+	}
+	cluster.Split("server1", "server2")
+	if err := cluster.JournalErr(); err == nil {
+		t.Fatalf("Expected the failed write to be kept")
+	}
+
+	// Later writes would leave a gap, they are not attempted
+	w.n = 10
+	cluster.Undo()
+	entries, err := ReadJournal(&w.buf)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 written entry but got %d, %v", len(entries), err)
+	}
+	if len(cluster.Journal()) != 3 {
+		t.Errorf("Expected 3 journal entries but got %d", len(cluster.Journal()))
+	}
+
+	cluster.SetJournalWriter(&bytes.Buffer{})
+	if err := cluster.JournalErr(); err != nil {
+		t.Errorf("Expected a new writer to clear the error but got %v", err)
+	}
+}
+
+func TestJournalWeights(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+	cluster.AddServer("server2", "5-9")
+	cluster.SetServerWeight("server1", 3)
+	cluster.ReplaceServer("server1", "server1b")
+	cluster.SetServerWeight("server2", 0)
+	cluster.Rebalance(false)
+
+	replayed := NewHashRingCluster(10)
+	if err := replayed.Replay(cluster.Journal()); err != nil {
+		t.Fatalf("Replay failed %v", err)
+	}
+	expectSameCluster(t, cluster, replayed)
+
+	cluster.Undo()
+	cluster.Undo()
+	if weight := cluster.findServer("server2").weight; weight != 1 {
+		t.Errorf("Undo did not restore the weight of server2 %v", weight)
+	}
+	cluster.Undo()
+	if weight := cluster.findServer("server1").weight; weight != 3 {
+		t.Errorf("Undo of the replace did not restore the weight of server1 %v", weight)
+	}
+	cluster.Undo()
+	if weight := cluster.findServer("server1").weight; weight != 1 {
+		t.Errorf("Undo did not restore the weight of server1 %v", weight)
+	}
+
+	// A weight that changed since the entry was recorded is a conflict
+	if err := cluster.apply(JournalEntry{Weights: []WeightChange{{Server: "server1", From: 2, To: 1}}}); err != ErrJournalConflict {
+		t.Errorf("Expected ErrJournalConflict, got %v", err)
+	}
+}
+
+func TestJournalLimit(t *testing.T) {
+	var buf bytes.Buffer
+	cluster := NewHashRingCluster(10)
+	cluster.SetJournalWriter(&buf)
+	cluster.AddServer("server1", "0-9")
+	cluster.Split("server1", "server2")
+	if err := cluster.SetJournalLimit(4); err != nil {
+		t.Fatalf("SetJournalLimit failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		cluster.AssignVNodes("server1", []int{i})
+	}
+
+	journal := cluster.Journal()
+	if len(journal) != 4 || journal[0].Seq != 4 || journal[3].Seq != 7 {
+		t.Fatalf("Unexpected journal %v", journal)
+	}
+	if entries, _ := ReadJournal(&buf); len(entries) != 7 {
+		t.Errorf("Expected the writer to get 7 entries, got %d", len(entries))
+	}
+
+	// Every undo journals an entry too, which pushes older changes out
+	before := owners(cluster)
+	if _, err := cluster.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if _, err := cluster.Redo(); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	expectOwners(t, cluster, before)
+	undone := 0
+	for ; undone < 10; undone++ {
+		if _, err := cluster.Undo(); err == ErrNothingToUndo {
+			break
+		}
+	}
+	if undone == 0 || undone >= 4 {
+		t.Errorf("Unexpected number of undos %d", undone)
+	}
+	if len(cluster.Journal()) != 4 {
+		t.Errorf("Journal grew past the limit %d", len(cluster.Journal()))
+	}
+
+	if err := cluster.SetJournalLimit(-1); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
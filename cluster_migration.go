@@ -0,0 +1,178 @@
+package hashring
+
+import (
+	"errors"
+	"strconv"
+)
+
+var (
+	ErrMigrationInProgress = errors.New("MIGRATIONINPROGRESS")
+	ErrNoMigration         = errors.New("NOMIGRATION")
+)
+
+type VNodeState int
+
+const (
+	// VNodeStable is a virtual node that is not moving.
+	VNodeStable VNodeState = iota
+	// VNodeMigrating is a virtual node that moves away from its owner.
+	VNodeMigrating
+	// VNodeImporting is a virtual node that moves to a server, as seen by
+	// that server.
+	VNodeImporting
+)
+
+// Route is where a key goes. While the virtual node of the key migrates,
+// Server is still its owner and Fallback the server it moves to, data not
+// found on one is on the other.
+type Route struct {
+	VNode    int
+	Server   string
+	Fallback string
+	State    VNodeState
+}
+
+// BeginMigration starts moving vnodes to target. Until CommitMigration the
+// virtual nodes keep their owner and GetRoute also returns target, which
+// does not have to be a server yet. Every virtual node must be assigned and
+// not migrating already. Migrations are neither journaled nor persisted,
+// loading, replaying or resizing the cluster drops them.
+func (hc *HashRingCluster) BeginMigration(target string, vnodes ...int) error {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	if target == "" || len(vnodes) == 0 {
+		return ErrInvalidInput
+	}
+	for _, i := range vnodes {
+		if i < 0 || i >= hc.numberOfVirtualNodes {
+			return ErrInvalidInput
+		}
+		serverInfo := hc.virtualNodes[i].serverInfo
+		if serverInfo == nil {
+			return ErrUnassignedVNode
+		}
+		if serverInfo.name == target {
+			return ErrInvalidInput
+		}
+		if _, ok := hc.migrations[i]; ok {
+			return ErrMigrationInProgress
+		}
+	}
+
+	if hc.migrations == nil {
+		hc.migrations = map[int]string{}
+	}
+	for _, i := range vnodes {
+		hc.migrations[i] = target
+	}
+	hc.generation++
+	return nil
+}
+
+// CommitMigration hands migrating vnodes to their targets in one journaled
+// change, targets that are not servers yet are created.
+func (hc *HashRingCluster) CommitMigration(vnodes ...int) ([]VNodeMove, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+	return hc.commitMigration(vnodes)
+}
+
+func (hc *HashRingCluster) commitMigration(vnodes []int) ([]VNodeMove, error) {
+	if len(vnodes) == 0 {
+		return nil, ErrInvalidInput
+	}
+	args := []string{}
+	for _, i := range vnodes {
+		target, ok := hc.migrations[i]
+		if !ok {
+			return nil, ErrNoMigration
+		}
+		args = append(args, strconv.Itoa(i), target)
+	}
+
+	return hc.record("migrate", args, func() ([]VNodeMove, error) {
+		moves := []VNodeMove{}
+		for _, i := range vnodes {
+			server := hc.findServer(hc.migrations[i])
+			if server == nil {
+				server = hc.newServer(hc.migrations[i])
+			}
+			moves = append(moves, hc.assign(i, server))
+		}
+		return moves, nil
+	})
+}
+
+// AbortMigration stops migrating vnodes, they stay with their owner.
+func (hc *HashRingCluster) AbortMigration(vnodes ...int) error {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	for _, i := range vnodes {
+		if _, ok := hc.migrations[i]; !ok {
+			return ErrNoMigration
+		}
+	}
+	for _, i := range vnodes {
+		delete(hc.migrations, i)
+	}
+	hc.generation++
+	return nil
+}
+
+// MigrationTarget returns the server virtual node i migrates to.
+func (hc *HashRingCluster) MigrationTarget(i int) (string, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	target, ok := hc.migrations[i]
+	return target, ok
+}
+
+// VNodeState returns the state of virtual node i as seen by server.
+func (hc *HashRingCluster) VNodeState(i int, server string) VNodeState {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	target, ok := hc.migrations[i]
+	switch {
+	case !ok:
+		return VNodeStable
+	case target == server:
+		return VNodeImporting
+	case hc.virtualNodes[i].serverInfo.name == server:
+		return VNodeMigrating
+	}
+	return VNodeStable
+}
+
+// GetRoute returns the route of key. Keys landing on a virtual node without
+// a server are handled by the UnassignedPolicy of the cluster.
+func (hc *HashRingCluster) GetRoute(key string) (Route, error) {
+	view := hc.loadView()
+	route := Route{VNode: -1}
+	view.walkVNodes(key, func(vnode int) bool {
+		if route.VNode < 0 {
+			route.VNode = vnode
+		}
+		if server := view.owners[vnode]; server != "" {
+			route.VNode = vnode
+			route.Server = server
+			if target, ok := view.migrations[vnode]; ok {
+				route.Fallback = target
+				route.State = VNodeMigrating
+			}
+			return false
+		}
+		if view.unassignedPolicy.Mode == UnassignedDefault {
+			route.Server = view.unassignedPolicy.Server
+		}
+		return view.unassignedPolicy.Mode == UnassignedNextAssigned
+	})
+
+	if route.Server == "" {
+		return Route{}, ErrUnassignedVNode
+	}
+	return route, nil
+}
@@ -0,0 +1,122 @@
+package hashring
+
+import (
+	"strconv"
+	"testing"
+)
+
+// keyOfVNode returns a key that lands on virtual node i.
+func keyOfVNode(cluster *HashRingCluster, i int) string {
+	for k := 0; ; k++ {
+		key := strconv.Itoa(k)
+		pos, _ := cluster.ring.GetNodePos(key)
+		if int(cluster.ring.nodeIndexAt(pos)) == i {
+			return key
+		}
+	}
+}
+
+func TestMigration(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+	key := keyOfVNode(cluster, 3)
+
+	if err := cluster.BeginMigration("server2", 3, 4); err != nil {
+		t.Fatalf("BeginMigration failed: %v", err)
+	}
+	route, err := cluster.GetRoute(key)
+	if err != nil || route != (Route{VNode: 3, Server: "server1", Fallback: "server2", State: VNodeMigrating}) {
+		t.Errorf("Unexpected route %v %v", route, err)
+	}
+	if cluster.GetServer(key) != "server1" {
+		t.Errorf("Owner should serve until the commit")
+	}
+	if cluster.VNodeState(3, "server1") != VNodeMigrating || cluster.VNodeState(3, "server2") != VNodeImporting || cluster.VNodeState(5, "server1") != VNodeStable {
+		t.Errorf("Unexpected states")
+	}
+
+	moves, err := cluster.CommitMigration(3, 4)
+	if err != nil || len(moves) != 2 {
+		t.Fatalf("CommitMigration failed: %v %v", moves, err)
+	}
+	route, _ = cluster.GetRoute(key)
+	if route != (Route{VNode: 3, Server: "server2"}) {
+		t.Errorf("Unexpected route after commit %v", route)
+	}
+	expectVNodeCount(t, cluster, "server2", 2)
+
+	journal := cluster.Journal()
+	if entry := journal[len(journal)-1]; entry.Op != "migrate" || len(entry.Created) != 1 {
+		t.Errorf("Unexpected journal entry %v", entry)
+	}
+	if _, err := cluster.Undo(); err != nil {
+		t.Errorf("Undo failed: %v", err)
+	}
+	if cluster.GetServerInfo("server2") != nil {
+		t.Errorf("Undo should retire server2")
+	}
+}
+
+func TestMigrationAbortAndCancel(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+
+	cluster.BeginMigration("server2", 3)
+	if err := cluster.AbortMigration(3); err != nil {
+		t.Errorf("AbortMigration failed: %v", err)
+	}
+	if _, ok := cluster.MigrationTarget(3); ok {
+		t.Errorf("Migration not aborted")
+	}
+
+	cluster.BeginMigration("server2", 3)
+	cluster.AddServer("server3", "3")
+	if _, ok := cluster.MigrationTarget(3); ok {
+		t.Errorf("Assign should cancel the migration")
+	}
+	if _, err := cluster.CommitMigration(3); err != ErrNoMigration {
+		t.Errorf("Expected ErrNoMigration, got %v", err)
+	}
+}
+
+func TestMigrationStalesPlans(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+
+	plan, _ := cluster.PlanAddServer("server3", "3")
+	cluster.BeginMigration("server2", 3)
+	if err := plan.Apply(); err != ErrStalePlan {
+		t.Errorf("Expected ErrStalePlan after BeginMigration, got %v", err)
+	}
+	if target, _ := cluster.MigrationTarget(3); target != "server2" {
+		t.Errorf("Migration lost")
+	}
+
+	plan, _ = cluster.PlanAddServer("server3", "3")
+	cluster.AbortMigration(3)
+	if err := plan.Apply(); err != ErrStalePlan {
+		t.Errorf("Expected ErrStalePlan after AbortMigration, got %v", err)
+	}
+}
+
+func TestMigrationErrors(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+
+	if err := cluster.BeginMigration("server2", 7); err != ErrUnassignedVNode {
+		t.Errorf("Expected ErrUnassignedVNode, got %v", err)
+	}
+	if err := cluster.BeginMigration("server1", 1); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+	cluster.BeginMigration("server2", 1)
+	if err := cluster.BeginMigration("server3", 2, 1); err != ErrMigrationInProgress {
+		t.Errorf("Expected ErrMigrationInProgress, got %v", err)
+	}
+	if _, ok := cluster.MigrationTarget(2); ok {
+		t.Errorf("Failed BeginMigration should not change anything")
+	}
+	if err := cluster.AbortMigration(1, 2); err != ErrNoMigration {
+		t.Errorf("Expected ErrNoMigration, got %v", err)
+	}
+}
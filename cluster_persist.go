@@ -0,0 +1,441 @@
+package hashring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Version of the JSON and binary cluster formats. Version 1, without server
+// weights, and version 2, without slot mode, are still read.
+const clusterFormatVersion = 3
+
+var clusterBinaryMagic = []byte("HRC")
+
+var (
+	ErrChecksumMismatch  = errors.New("CHECKSUMMISMATCH")
+	ErrUnsupportedFormat = errors.New("UNSUPPORTEDFORMAT")
+)
+
+// clusterState is the persisted part of a HashRingCluster. owners holds the
+// index into servers of the owner of every virtual node, or -1.
+type clusterState struct {
+	numberOfVirtualNodes int
+	slots                bool
+	servers              []string
+	weights              []float64
+	owners               []int
+	unassignedPolicy     UnassignedPolicy
+}
+
+func (hc *HashRingCluster) state() clusterState {
+	state := clusterState{
+		numberOfVirtualNodes: hc.numberOfVirtualNodes,
+		slots:                hc.slots,
+		servers:              make([]string, len(hc.servers)),
+		weights:              make([]float64, len(hc.servers)),
+		owners:               make([]int, hc.numberOfVirtualNodes),
+		unassignedPolicy:     hc.unassignedPolicy,
+	}
+	for i, server := range hc.servers {
+		state.servers[i] = server.name
+		state.weights[i] = server.weight
+	}
+	for i, vnode := range hc.virtualNodes {
+		state.owners[i] = -1
+		if vnode.serverInfo != nil {
+			state.owners[i] = vnode.serverInfo.idx
+		}
+	}
+	return state
+}
+
+func newClusterFromState(state clusterState) (*HashRingCluster, error) {
+	if state.numberOfVirtualNodes < 0 || len(state.owners) != state.numberOfVirtualNodes || len(state.weights) != len(state.servers) {
+		return nil, ErrInvalidInput
+	}
+	if state.slots && state.numberOfVirtualNodes != SlotCount {
+		return nil, ErrInvalidInput
+	}
+
+	if !validPolicy(state.unassignedPolicy) {
+		return nil, ErrInvalidInput
+	}
+
+	cluster := newCluster(state.numberOfVirtualNodes, state.slots)
+	cluster.unassignedPolicy = state.unassignedPolicy
+	for i, name := range state.servers {
+		if name == "" || cluster.findServer(name) != nil {
+			return nil, ErrInvalidInput
+		}
+		if !validWeight(state.weights[i]) {
+			return nil, ErrInvalidInput
+		}
+		cluster.newServer(name).weight = state.weights[i]
+	}
+	for i, owner := range state.owners {
+		if owner < -1 || owner >= len(cluster.servers) {
+			return nil, ErrInvalidInput
+		}
+		if owner >= 0 {
+			cluster.assign(i, cluster.servers[owner])
+		}
+	}
+	cluster.publish()
+	return cluster, nil
+}
+
+// load replaces the contents of hc with the loaded cluster. The journal
+// starts over, its entries do not lead to the loaded state.
+func (hc *HashRingCluster) load(cluster *HashRingCluster) {
+	hc.restore(cluster)
+	hc.journal.entries = nil
+	hc.journal.undo = nil
+	hc.journal.redo = nil
+	hc.journal.base = 0
+}
+
+// restore replaces the contents of hc with cluster.
+func (hc *HashRingCluster) restore(cluster *HashRingCluster) {
+	hc.ring = cluster.ring
+	hc.numberOfVirtualNodes = cluster.numberOfVirtualNodes
+	hc.servers = cluster.servers
+	hc.virtualToServerMapping = cluster.virtualToServerMapping
+	hc.virtualNodes = cluster.virtualNodes
+	hc.unassignedPolicy = cluster.unassignedPolicy
+	hc.slots = cluster.slots
+	hc.migrations = cluster.migrations
+	hc.generation++
+}
+
+// encodeState returns the binary encoding of state in the given format
+// version without the checksum.
+func encodeState(state clusterState, version byte) []byte {
+	var buf bytes.Buffer
+	var scratch [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+	}
+	putString := func(s string) {
+		putUvarint(uint64(len(s)))
+		buf.WriteString(s)
+	}
+
+	buf.Write(clusterBinaryMagic)
+	buf.WriteByte(version)
+	putUvarint(uint64(state.numberOfVirtualNodes))
+	if version >= 3 {
+		slots := uint64(0)
+		if state.slots {
+			slots = 1
+		}
+		putUvarint(slots)
+	}
+	putUvarint(uint64(state.unassignedPolicy.Mode))
+	putString(state.unassignedPolicy.Server)
+	putUvarint(uint64(len(state.servers)))
+	for i, name := range state.servers {
+		putString(name)
+		if version >= 2 {
+			binary.Write(&buf, binary.BigEndian, math.Float64bits(state.weights[i]))
+		}
+	}
+	for _, owner := range state.owners {
+		putUvarint(uint64(owner + 1))
+	}
+	return buf.Bytes()
+}
+
+func decodeState(data []byte) (clusterState, error) {
+	state := clusterState{}
+	if len(data) < len(clusterBinaryMagic)+1 || !bytes.Equal(data[:len(clusterBinaryMagic)], clusterBinaryMagic) {
+		return state, ErrUnsupportedFormat
+	}
+	version := data[len(clusterBinaryMagic)]
+	if version < 1 || version > clusterFormatVersion {
+		return state, ErrUnsupportedFormat
+	}
+
+	r := bytes.NewReader(data[len(clusterBinaryMagic)+1:])
+	var err error
+	uvarint := func() int {
+		if err != nil {
+			return 0
+		}
+		var v uint64
+		v, err = binary.ReadUvarint(r)
+		if err == nil && v > uint64(len(data)) {
+			// No count or length can exceed the size of the input
+			err = ErrInvalidInput
+		}
+		return int(v)
+	}
+	str := func() string {
+		n := uvarint()
+		if err != nil {
+			return ""
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return string(b)
+	}
+	weight := func() float64 {
+		if err != nil || version < 2 {
+			return 1
+		}
+		var bits uint64
+		err = binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits)
+	}
+
+	state.numberOfVirtualNodes = uvarint()
+	if version >= 3 {
+		switch uvarint() {
+		case 0:
+		case 1:
+			state.slots = true
+		default:
+			err = ErrInvalidInput
+		}
+	}
+	state.unassignedPolicy.Mode = UnassignedMode(uvarint())
+	state.unassignedPolicy.Server = str()
+	state.servers = make([]string, uvarint())
+	state.weights = make([]float64, len(state.servers))
+	for i := 0; i < len(state.servers) && err == nil; i++ {
+		state.servers[i] = str()
+		state.weights[i] = weight()
+	}
+	state.owners = make([]int, state.numberOfVirtualNodes)
+	for i := 0; i < len(state.owners) && err == nil; i++ {
+		state.owners[i] = uvarint() - 1
+	}
+	if err == nil && r.Len() != 0 {
+		err = ErrInvalidInput
+	}
+	if err != nil {
+		return state, ErrInvalidInput
+	}
+	return state, nil
+}
+
+// MarshalBinary encodes the cluster in the compact binary format, a CRC32
+// of the contents is appended.
+func (hc *HashRingCluster) MarshalBinary() ([]byte, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	data := encodeState(hc.state(), clusterFormatVersion)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	return append(data, sum[:]...), nil
+}
+
+// UnmarshalBinary replaces the cluster with one encoded by MarshalBinary
+// and clears its journal.
+func (hc *HashRingCluster) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return ErrUnsupportedFormat
+	}
+	payload := data[:len(data)-4]
+	if bytes.HasPrefix(payload, clusterBinaryMagic) && crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return ErrChecksumMismatch
+	}
+
+	state, err := decodeState(payload)
+	if err != nil {
+		return err
+	}
+	cluster, err := newClusterFromState(state)
+	if err != nil {
+		return err
+	}
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+	hc.load(cluster)
+	return nil
+}
+
+type clusterJSON struct {
+	Version          int                 `json:"version"`
+	VirtualNodes     int                 `json:"virtualNodes"`
+	Slots            bool                `json:"slots,omitempty"`
+	Servers          []clusterServerJSON `json:"servers"`
+	UnassignedPolicy *unassignedJSON     `json:"unassignedPolicy,omitempty"`
+	Checksum         string              `json:"checksum"`
+}
+
+type clusterServerJSON struct {
+	Name   string   `json:"name"`
+	Weight *float64 `json:"weight,omitempty"`
+	VNodes []int    `json:"vnodes"`
+}
+
+type unassignedJSON struct {
+	Mode   UnassignedMode `json:"mode"`
+	Server string         `json:"server,omitempty"`
+}
+
+func stateChecksum(state clusterState, version byte) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(encodeState(state, version)))
+}
+
+// MarshalJSON encodes the cluster in the versioned JSON format. The
+// checksum covers the binary encoding of the same state.
+func (hc *HashRingCluster) MarshalJSON() ([]byte, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	state := hc.state()
+	out := clusterJSON{
+		Version:      clusterFormatVersion,
+		VirtualNodes: state.numberOfVirtualNodes,
+		Slots:        state.slots,
+		Servers:      make([]clusterServerJSON, len(state.servers)),
+		Checksum:     stateChecksum(state, clusterFormatVersion),
+	}
+	for i, name := range state.servers {
+		out.Servers[i] = clusterServerJSON{Name: name, Weight: &state.weights[i], VNodes: []int{}}
+	}
+	for i, owner := range state.owners {
+		if owner >= 0 {
+			out.Servers[owner].VNodes = append(out.Servers[owner].VNodes, i)
+		}
+	}
+	if state.unassignedPolicy != (UnassignedPolicy{}) {
+		out.UnassignedPolicy = &unassignedJSON{Mode: state.unassignedPolicy.Mode, Server: state.unassignedPolicy.Server}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON replaces the cluster with one encoded by MarshalJSON and
+// clears its journal.
+func (hc *HashRingCluster) UnmarshalJSON(data []byte) error {
+	in := clusterJSON{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Version < 1 || in.Version > clusterFormatVersion {
+		return ErrUnsupportedFormat
+	}
+	if in.VirtualNodes < 0 {
+		return ErrInvalidInput
+	}
+
+	state := clusterState{
+		numberOfVirtualNodes: in.VirtualNodes,
+		slots:                in.Slots && in.Version >= 3,
+		servers:              make([]string, len(in.Servers)),
+		weights:              make([]float64, len(in.Servers)),
+		owners:               make([]int, in.VirtualNodes),
+	}
+	for i := range state.owners {
+		state.owners[i] = -1
+	}
+	for i, server := range in.Servers {
+		state.servers[i] = server.Name
+		state.weights[i] = 1
+		if server.Weight != nil && in.Version >= 2 {
+			state.weights[i] = *server.Weight
+		}
+		for _, vnode := range server.VNodes {
+			if vnode < 0 || vnode >= in.VirtualNodes || state.owners[vnode] != -1 {
+				return ErrInvalidInput
+			}
+			state.owners[vnode] = i
+		}
+	}
+	if in.UnassignedPolicy != nil {
+		state.unassignedPolicy = UnassignedPolicy{Mode: in.UnassignedPolicy.Mode, Server: in.UnassignedPolicy.Server}
+	}
+
+	if stateChecksum(state, byte(in.Version)) != in.Checksum {
+		return ErrChecksumMismatch
+	}
+
+	cluster, err := newClusterFromState(state)
+	if err != nil {
+		return err
+	}
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+	hc.load(cluster)
+	return nil
+}
+
+// SaveJSON atomically writes the cluster to path in the JSON format.
+func (hc *HashRingCluster) SaveJSON(path string) error {
+	data, err := json.MarshalIndent(hc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// SaveBinary atomically writes the cluster to path in the binary format.
+func (hc *HashRingCluster) SaveBinary(path string) error {
+	data, err := hc.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// LoadHashRingCluster reads a cluster written by SaveJSON or SaveBinary.
+func LoadHashRingCluster(path string) (*HashRingCluster, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := &HashRingCluster{}
+	if bytes.HasPrefix(data, clusterBinaryMagic) {
+		err = cluster.UnmarshalBinary(data)
+	} else {
+		err = cluster.UnmarshalJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path, so readers see either the old or the new contents.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package hashring
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func persistTestCluster() *HashRingCluster {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-39")
+	cluster.AddServer("server2", "40-79")
+	cluster.AddServer("server3", "60-69,90-95")
+	cluster.SetServerWeight("server2", 2.5)
+	cluster.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedDefault, Server: "fallback"})
+	return cluster
+}
+
+func expectSameCluster(t *testing.T, expected *HashRingCluster, actual *HashRingCluster) {
+	if actual.numberOfVirtualNodes != expected.numberOfVirtualNodes {
+		t.Fatalf("Expected %d virtual nodes but got %d", expected.numberOfVirtualNodes, actual.numberOfVirtualNodes)
+	}
+	if len(actual.servers) != len(expected.servers) {
+		t.Fatalf("Expected %d servers but got %d", len(expected.servers), len(actual.servers))
+	}
+	for i, server := range expected.servers {
+		if actual.servers[i].name != server.name {
+			t.Errorf("Server %d expected %s but got %s", i, server.name, actual.servers[i].name)
+		}
+		if actual.servers[i].weight != server.weight {
+			t.Errorf("Server %s expected weight %v but got %v", server.name, server.weight, actual.servers[i].weight)
+		}
+		expectVNodeCount(t, actual, server.name, len(server.virtualNodes))
+	}
+	for i := 0; i < expected.numberOfVirtualNodes; i++ {
+		eServer, aServer := expected.virtualNodes[i].serverInfo, actual.virtualNodes[i].serverInfo
+		if (eServer == nil) != (aServer == nil) || (eServer != nil && eServer.name != aServer.name) {
+			t.Errorf("Virtual node %d has a different owner", i)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if expected.GetServer(key) != actual.GetServer(key) {
+			t.Errorf("GetServer(%s) expected %s but got %s", key, expected.GetServer(key), actual.GetServer(key))
+		}
+	}
+}
+
+func TestClusterJSONRoundTrip(t *testing.T) {
+	cluster := persistTestCluster()
+	data, err := json.Marshal(cluster)
+	if err != nil {
+		t.Fatalf("Failed to marshal %v", err)
+	}
+
+	restored := &HashRingCluster{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Failed to unmarshal %v", err)
+	}
+	expectSameCluster(t, cluster, restored)
+	if restored.unassignedPolicy != cluster.unassignedPolicy {
+		t.Errorf("Unassigned policy not restored %v", restored.unassignedPolicy)
+	}
+}
+
+func TestClusterBinaryRoundTrip(t *testing.T) {
+	cluster := persistTestCluster()
+	data, err := cluster.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal %v", err)
+	}
+
+	restored := &HashRingCluster{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal %v", err)
+	}
+	expectSameCluster(t, cluster, restored)
+}
+
+func TestClusterChecksum(t *testing.T) {
+	cluster := persistTestCluster()
+
+	data, _ := cluster.MarshalBinary()
+	data[len(data)-10]++
+	if err := (&HashRingCluster{}).UnmarshalBinary(data); err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch but got %v", err)
+	}
+
+	in := clusterJSON{}
+	data, _ = json.Marshal(cluster)
+	json.Unmarshal(data, &in)
+	in.Servers[0].VNodes = in.Servers[0].VNodes[1:]
+	data, _ = json.Marshal(in)
+	if err := json.Unmarshal(data, &HashRingCluster{}); err != ErrChecksumMismatch {
+		t.Errorf("Expected ErrChecksumMismatch but got %v", err)
+	}
+
+	in.Version = clusterFormatVersion + 1
+	data, _ = json.Marshal(in)
+	if err := json.Unmarshal(data, &HashRingCluster{}); err != ErrUnsupportedFormat {
+		t.Errorf("Expected ErrUnsupportedFormat but got %v", err)
+	}
+}
+
+func TestClusterVersion1(t *testing.T) {
+	cluster := persistTestCluster()
+	cluster.SetServerWeight("server2", 1)
+
+	state := cluster.state()
+	data := encodeState(state, 1)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	restored := &HashRingCluster{}
+	if err := restored.UnmarshalBinary(append(data, sum[:]...)); err != nil {
+		t.Fatalf("Failed to unmarshal version 1 %v", err)
+	}
+	expectSameCluster(t, cluster, restored)
+
+	in := clusterJSON{}
+	data, _ = json.Marshal(cluster)
+	json.Unmarshal(data, &in)
+	in.Version = 1
+	in.Checksum = stateChecksum(state, 1)
+	for i := range in.Servers {
+		in.Servers[i].Weight = nil
+	}
+	data, _ = json.Marshal(in)
+	restored = &HashRingCluster{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Failed to unmarshal version 1 %v", err)
+	}
+	expectSameCluster(t, cluster, restored)
+}
+
+func TestClusterBinaryTruncated(t *testing.T) {
+	data, _ := persistTestCluster().MarshalBinary()
+	for i := 0; i < len(data); i++ {
+		if err := (&HashRingCluster{}).UnmarshalBinary(data[:i]); err == nil {
+			t.Fatalf("Truncated input of %d bytes accepted", i)
+		}
+	}
+}
+
+func TestClusterSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cluster := persistTestCluster()
+	for _, save := range []func(string) error{cluster.SaveJSON, cluster.SaveBinary} {
+		path := filepath.Join(dir, "cluster")
+		if err := save(path); err != nil {
+			t.Fatalf("Failed to save %v", err)
+		}
+		restored, err := LoadHashRingCluster(path)
+		if err != nil {
+			t.Fatalf("Failed to load %v", err)
+		}
+		expectSameCluster(t, cluster, restored)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Expected only the cluster file but found %d files", len(files))
+	}
+
+	if _, err := LoadHashRingCluster(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Loading a missing file succeeded")
+	}
+}
+
+func TestClusterLoadClearsJournal(t *testing.T) {
+	data, _ := persistTestCluster().MarshalBinary()
+	jsonData, _ := json.Marshal(persistTestCluster())
+
+	for _, unmarshal := range []func(*HashRingCluster) error{
+		func(c *HashRingCluster) error { return c.UnmarshalBinary(data) },
+		func(c *HashRingCluster) error { return json.Unmarshal(jsonData, c) },
+	} {
+		cluster := NewHashRingCluster(persistTestCluster().numberOfVirtualNodes)
+		cluster.AddServer("other", "0")
+		cluster.AddServer("other2", "1")
+		cluster.Undo()
+		if err := unmarshal(cluster); err != nil {
+			t.Fatalf("Failed to unmarshal %v", err)
+		}
+		if len(cluster.Journal()) != 0 {
+			t.Errorf("Journal kept %d entries", len(cluster.Journal()))
+		}
+		if _, err := cluster.Undo(); err != ErrNothingToUndo {
+			t.Errorf("Expected ErrNothingToUndo, got %v", err)
+		}
+		if _, err := cluster.Redo(); err != ErrNothingToRedo {
+			t.Errorf("Expected ErrNothingToRedo, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package hashring
+
+import (
+	"errors"
+)
+
+// ErrStalePlan is returned when a plan is applied to a cluster that changed
+// since the plan was made.
+var ErrStalePlan = errors.New("STALEPLAN")
+
+// Plan is a previewed change of a HashRingCluster. It can be inspected and
+// then applied as a whole.
+type Plan struct {
+	Op      string
+	Args    []string
+	Created []string
+	Retired []string
+	Moves   []VNodeMove
+	// Before and After hold the number of virtual nodes of every server
+	// involved, before and after the change.
+	Before map[string]int
+	After  map[string]int
+	// KeyspaceFraction estimates the fraction of the keyspace that changes
+	// owner, from the ring arcs of the moved virtual nodes.
+	KeyspaceFraction float64
+	// Weights holds the servers whose weight changes, UnassignedPolicy is
+	// set if the policy changes.
+	Weights          map[string]float64
+	UnassignedPolicy *UnassignedPolicy
+
+	cluster    *HashRingCluster
+	generation uint64
+	weights    []WeightChange
+	policy     *PolicyChange
+}
+
+// plan runs fn on a copy of the cluster and turns the change it journals
+// into a Plan.
+func (hc *HashRingCluster) plan(fn func(cluster *HashRingCluster) error) (*Plan, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	cluster, err := newClusterFromState(hc.state())
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(cluster); err != nil {
+		return nil, err
+	}
+	entry := cluster.journal.entries[len(cluster.journal.entries)-1]
+
+	plan := &Plan{
+		Op:         entry.Op,
+		Args:       entry.Args,
+		Created:    entry.Created,
+		Retired:    entry.Retired,
+		Moves:      entry.Moves,
+		Before:     map[string]int{},
+		After:      map[string]int{},
+		Weights:    map[string]float64{},
+		cluster:    hc,
+		generation: hc.generation,
+		weights:    entry.Weights,
+		policy:     entry.Policy,
+	}
+	for _, c := range []*HashRingCluster{hc, cluster} {
+		for _, server := range c.servers {
+			plan.Before[server.name] = 0
+			plan.After[server.name] = 0
+		}
+	}
+	for _, server := range hc.servers {
+		plan.Before[server.name] = len(server.virtualNodes)
+	}
+	for _, server := range cluster.servers {
+		plan.After[server.name] = len(server.virtualNodes)
+		if old := hc.findServer(server.name); (old == nil && server.weight != 1) || (old != nil && old.weight != server.weight) {
+			plan.Weights[server.name] = server.weight
+		}
+	}
+	if cluster.unassignedPolicy != hc.unassignedPolicy {
+		policy := cluster.unassignedPolicy
+		plan.UnassignedPolicy = &policy
+	}
+
+	keyspace := hc.vnodeKeyspace()
+	for _, move := range plan.Moves {
+		plan.KeyspaceFraction += keyspace[move.VNode]
+	}
+	return plan, nil
+}
+
+// vnodeKeyspace returns the fraction of the keyspace that maps to every
+// virtual node.
+func (hc *HashRingCluster) vnodeKeyspace() []float64 {
+	keyspace := make([]float64, hc.numberOfVirtualNodes)
+	if hc.slots {
+		// CRC16 spreads keys evenly over the slots
+		for i := range keyspace {
+			keyspace[i] = 1.0 / SlotCount
+		}
+		return keyspace
+	}
+	for pos := 0; pos < hc.ring.numPoints(); pos++ {
+		// The ring nodes are the virtual node names in index order
+		keyspace[hc.ring.nodeIndexAt(pos)] += hc.ring.arcFraction(pos)
+	}
+	return keyspace
+}
+
+// Apply runs the planned change on the cluster it was made for and journals
+// it like the operation it previews. It fails with ErrStalePlan if the
+// cluster changed since the plan was made.
+func (p *Plan) Apply() error {
+	p.cluster.mu.Lock()
+	defer p.cluster.publishUnlock()
+
+	if p.cluster.generation != p.generation {
+		return ErrStalePlan
+	}
+
+	_, err := p.cluster.record(p.Op, p.Args, func() ([]VNodeMove, error) {
+		entry := JournalEntry{Created: p.Created, Retired: p.Retired, Weights: p.weights, Policy: p.policy, Moves: p.Moves}
+		if err := p.cluster.apply(entry); err != nil {
+			return nil, err
+		}
+		return p.Moves, nil
+	})
+	return err
+}
+
+// PlanAddServer previews AddServer.
+func (hc *HashRingCluster) PlanAddServer(name string, rangeString string) (*Plan, error) {
+	return hc.plan(func(cluster *HashRingCluster) error {
+		return cluster.AddServer(name, rangeString)
+	})
+}
+
+// PlanSplit previews Split.
+func (hc *HashRingCluster) PlanSplit(serverName string, newServerName string) (*Plan, error) {
+	return hc.plan(func(cluster *HashRingCluster) error {
+		return cluster.Split(serverName, newServerName)
+	})
+}
+
+// PlanRemoveServer previews RemoveServer.
+func (hc *HashRingCluster) PlanRemoveServer(name string, policy RemovePolicy) (*Plan, error) {
+	return hc.plan(func(cluster *HashRingCluster) error {
+		_, err := cluster.RemoveServer(name, policy)
+		return err
+	})
+}
+
+// PlanRebalance previews Rebalance.
+func (hc *HashRingCluster) PlanRebalance() (*Plan, error) {
+	return hc.plan(func(cluster *HashRingCluster) error {
+		_, err := cluster.Rebalance(false)
+		return err
+	})
+}
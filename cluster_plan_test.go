@@ -0,0 +1,95 @@
+package hashring
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestPlanAddServer(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-99")
+	before := owners(cluster)
+
+	plan, err := cluster.PlanAddServer("server2", "50-99")
+	if err != nil {
+		t.Fatalf("PlanAddServer failed: %v", err)
+	}
+	expectOwners(t, cluster, before)
+	if len(plan.Moves) != 50 || len(plan.Created) != 1 || plan.Created[0] != "server2" {
+		t.Errorf("Unexpected plan %v", plan)
+	}
+	if plan.Before["server1"] != 100 || plan.Before["server2"] != 0 {
+		t.Errorf("Unexpected counts before %v", plan.Before)
+	}
+	if plan.After["server1"] != 50 || plan.After["server2"] != 50 {
+		t.Errorf("Unexpected counts after %v", plan.After)
+	}
+
+	// The estimate must match the keys that actually move
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		pos, _ := cluster.ring.GetNodePos(strconv.Itoa(i))
+		if cluster.ring.nodeIndexAt(pos) >= 50 {
+			moved++
+		}
+	}
+	if math.Abs(plan.KeyspaceFraction-float64(moved)/10000) > 0.02 {
+		t.Errorf("KeyspaceFraction %v, but %d of 10000 keys move", plan.KeyspaceFraction, moved)
+	}
+
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 50)
+	expectVNodeCount(t, cluster, "server2", 50)
+	journal := cluster.Journal()
+	if entry := journal[len(journal)-1]; entry.Op != "add" || len(entry.Moves) != 50 {
+		t.Errorf("Apply journaled %v", entry)
+	}
+}
+
+func TestPlanSplit(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-99")
+
+	plan, err := cluster.PlanSplit("server1", "server2")
+	if err != nil {
+		t.Fatalf("PlanSplit failed: %v", err)
+	}
+	if plan.After["server1"] != 50 || plan.After["server2"] != 50 {
+		t.Errorf("Unexpected counts after %v", plan.After)
+	}
+	if plan.KeyspaceFraction <= 0 || plan.KeyspaceFraction >= 1 {
+		t.Errorf("Unexpected KeyspaceFraction %v", plan.KeyspaceFraction)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	expectVNodeCount(t, cluster, "server2", 50)
+
+	if _, err := cluster.PlanSplit("server3", "server4"); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound, got %v", err)
+	}
+}
+
+func TestPlanStale(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-99")
+
+	plan, _ := cluster.PlanRemoveServer("server1", RemovePolicy{Mode: RemoveUnassign})
+	cluster.AddServer("server2", "0")
+	before := owners(cluster)
+	if err := plan.Apply(); err != ErrStalePlan {
+		t.Errorf("Expected ErrStalePlan, got %v", err)
+	}
+	expectOwners(t, cluster, before)
+
+	plan, _ = cluster.PlanRebalance()
+	if err := plan.Apply(); err != nil {
+		t.Errorf("Apply failed: %v", err)
+	}
+	if err := plan.Apply(); err != ErrStalePlan {
+		t.Errorf("Expected ErrStalePlan on the second Apply, got %v", err)
+	}
+}
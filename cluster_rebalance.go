@@ -0,0 +1,105 @@
+package hashring
+
+import (
+	"sort"
+)
+
+// rebalanceTargets returns the number of virtual nodes every server should
+// own, in the order of hc.servers, in proportion to the server weights. The
+// shares are rounded down and the virtual nodes left over go to the largest
+// remainders, ties to the servers that already own more virtual nodes, so
+// fewer virtual nodes move.
+func (hc *HashRingCluster) rebalanceTargets() ([]int, error) {
+	total := 0.0
+	for _, server := range hc.servers {
+		total += server.weight
+	}
+	if !(total > 0) {
+		return nil, ErrInvalidInput
+	}
+
+	targets := make([]int, len(hc.servers))
+	remainders := make([]float64, len(hc.servers))
+	left := hc.numberOfVirtualNodes
+	for i, server := range hc.servers {
+		share := float64(hc.numberOfVirtualNodes) * server.weight / total
+		targets[i] = int(share)
+		remainders[i] = share - float64(targets[i])
+		left -= targets[i]
+	}
+
+	order := make([]*ServerInfo, len(hc.servers))
+	copy(order, hc.servers)
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if remainders[a.idx] != remainders[b.idx] {
+			return remainders[a.idx] > remainders[b.idx]
+		}
+		return len(a.virtualNodes) > len(b.virtualNodes)
+	})
+	for i := 0; i < left; i++ {
+		targets[order[i%len(order)].idx]++
+	}
+	return targets, nil
+}
+
+// planRebalance returns the fewest moves that give every server its target
+// number of virtual nodes. Unassigned virtual nodes are handed out first,
+// servers above their target give up their highest virtual nodes.
+func (hc *HashRingCluster) planRebalance(targets []int) []VNodeMove {
+	pool := []VNodeMove{}
+	for _, vnode := range hc.virtualNodes {
+		if vnode.serverInfo == nil {
+			pool = append(pool, VNodeMove{VNode: vnode.idx})
+		}
+	}
+	for _, server := range hc.servers {
+		vnodes := sortedVNodes(server)
+		for k := targets[server.idx]; k < len(vnodes); k++ {
+			pool = append(pool, VNodeMove{VNode: vnodes[k], From: server.name})
+		}
+	}
+
+	moves := []VNodeMove{}
+	for _, server := range hc.servers {
+		for n := len(server.virtualNodes); n < targets[server.idx] && len(pool) > 0; n++ {
+			move := pool[0]
+			pool = pool[1:]
+			move.To = server.name
+			moves = append(moves, move)
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].VNode < moves[j].VNode })
+	return moves
+}
+
+// Rebalance assigns unowned virtual nodes and moves as few virtual nodes as
+// possible so every server owns its share of the virtual nodes in proportion
+// to its weight, see SetServerWeight. With equal weights every server owns
+// either the floor or the ceiling of numberOfVirtualNodes/len(servers). It
+// returns the moves, with dryRun they are only planned and the cluster is
+// left unchanged.
+func (hc *HashRingCluster) Rebalance(dryRun bool) ([]VNodeMove, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	if len(hc.servers) == 0 {
+		return nil, ErrNoServers
+	}
+
+	targets, err := hc.rebalanceTargets()
+	if err != nil {
+		return nil, err
+	}
+	moves := hc.planRebalance(targets)
+	if dryRun {
+		return moves, nil
+	}
+
+	return hc.record("rebalance", nil, func() ([]VNodeMove, error) {
+		for _, move := range moves {
+			hc.assign(move.VNode, hc.findServer(move.To))
+		}
+		return moves, nil
+	})
+}
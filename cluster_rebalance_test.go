@@ -0,0 +1,130 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func TestRebalance(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-79")
+	cluster.AddServer("server2", "80-89")
+	cluster.AddServer("server3", "90-99")
+
+	moves, err := cluster.Rebalance(false)
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	// server1 keeps the remainder, 34+33+33
+	if len(moves) != 46 {
+		t.Errorf("Expected 46 moves, got %d", len(moves))
+	}
+	for _, move := range moves {
+		if move.From != "server1" {
+			t.Errorf("Unexpected move %v", move)
+		}
+	}
+	expectVNodeCount(t, cluster, "server1", 34)
+	expectVNodeCount(t, cluster, "server2", 33)
+	expectVNodeCount(t, cluster, "server3", 33)
+
+	moves, err = cluster.Rebalance(false)
+	if err != nil || len(moves) != 0 {
+		t.Errorf("Expected no moves on a balanced cluster, got %v %v", moves, err)
+	}
+}
+
+func TestRebalanceAssignsUnowned(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-5")
+	cluster.AddServer("server2", "6")
+
+	moves, err := cluster.Rebalance(false)
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	// vnodes 7-9 are unassigned and server1 gives up 1
+	if len(moves) != 4 {
+		t.Errorf("Expected 4 moves, got %v", moves)
+	}
+	expectVNodeCount(t, cluster, "server1", 5)
+	expectVNodeCount(t, cluster, "server2", 5)
+	for i, owner := range owners(cluster) {
+		if owner == "" {
+			t.Errorf("Virtual node %d is unassigned", i)
+		}
+	}
+}
+
+func TestRebalanceDryRun(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+	cluster.AddServer("server2", "0")
+	before := owners(cluster)
+
+	moves, err := cluster.Rebalance(true)
+	if err != nil || len(moves) != 4 {
+		t.Errorf("Expected 4 planned moves, got %v %v", moves, err)
+	}
+	expectOwners(t, cluster, before)
+	if len(cluster.Journal()) != 2 {
+		t.Errorf("Dry run should not be journaled")
+	}
+
+	cluster.Rebalance(false)
+	if _, err := cluster.Undo(); err != nil {
+		t.Errorf("Undo failed: %v", err)
+	}
+	expectOwners(t, cluster, before)
+}
+
+func TestRebalanceNoServers(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	if _, err := cluster.Rebalance(false); err != ErrNoServers {
+		t.Errorf("Expected ErrNoServers, got %v", err)
+	}
+}
+
+func TestRebalanceWeighted(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "50-99")
+	cluster.AddServer("server3", "0")
+	cluster.SetServerWeight("server1", 1)
+	cluster.SetServerWeight("server2", 2)
+	cluster.SetServerWeight("server3", 3)
+
+	moves, err := cluster.Rebalance(false)
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	// 16.7/33.3/50 rounds to 17/33/50, server3 already owns 1
+	expectVNodeCount(t, cluster, "server1", 17)
+	expectVNodeCount(t, cluster, "server2", 33)
+	expectVNodeCount(t, cluster, "server3", 50)
+	if len(moves) != 49 {
+		t.Errorf("Expected 49 moves, got %d", len(moves))
+	}
+
+	cluster.SetServerWeight("server3", 0)
+	cluster.Rebalance(false)
+	expectVNodeCount(t, cluster, "server1", 33)
+	expectVNodeCount(t, cluster, "server2", 67)
+	expectVNodeCount(t, cluster, "server3", 0)
+}
+
+func TestSetServerWeightErrors(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+
+	if err := cluster.SetServerWeight("server2", 1); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound, got %v", err)
+	}
+	if err := cluster.SetServerWeight("server1", -1); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+
+	cluster.SetServerWeight("server1", 0)
+	if _, err := cluster.Rebalance(false); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput without any weight, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package hashring
+
+import (
+	"math"
+	"strconv"
+)
+
+// ResizeReport describes the effect of Resize.
+type ResizeReport struct {
+	From int
+	To   int
+	// MovedFraction is the fraction of the keyspace whose virtual node owner
+	// changed.
+	MovedFraction float64
+
+	before *HashRingCluster
+	after  *HashRingCluster
+}
+
+// AffectedKeys returns the keys that GetServer maps to a different server
+// after the resize.
+func (r *ResizeReport) AffectedKeys(keys []string) []string {
+	affected := []string{}
+	for _, key := range keys {
+		if r.before.GetServer(key) != r.after.GetServer(key) {
+			affected = append(affected, key)
+		}
+	}
+	return affected
+}
+
+// ownerNames returns the name of the owner of every virtual node, "" for
+// none.
+func (hc *HashRingCluster) ownerNames() []string {
+	names := make([]string, hc.numberOfVirtualNodes)
+	for i, vnode := range hc.virtualNodes {
+		if vnode.serverInfo != nil {
+			names[i] = vnode.serverInfo.name
+		}
+	}
+	return names
+}
+
+// Resize changes the number of virtual nodes of the cluster. Every virtual
+// node of the new ring goes to the server that owned most of its hash arc
+// on the old ring, or stays unassigned if most of the arc was unassigned.
+// Growing e.g. from 64 to 128 virtual nodes keeps most keys in place. The
+// number of slots of a slot cluster is fixed.
+func (hc *HashRingCluster) Resize(numberOfVirtualNodes int) (*ResizeReport, error) {
+	hc.mu.Lock()
+	defer hc.publishUnlock()
+
+	if numberOfVirtualNodes <= 0 || hc.slots {
+		return nil, ErrInvalidInput
+	}
+
+	before, err := newClusterFromState(hc.state())
+	if err != nil {
+		return nil, err
+	}
+
+	nodeNames := make([]string, numberOfVirtualNodes)
+	for i := range nodeNames {
+		nodeNames[i] = strconv.Itoa(i)
+	}
+	ring := New(nodeNames)
+
+	// Overlap of every new virtual node with the old owners, the unassigned
+	// part is counted at index len(hc.servers)
+	overlap := make([][]uint64, numberOfVirtualNodes)
+	for i := range overlap {
+		overlap[i] = make([]uint64, len(hc.servers)+1)
+	}
+	ownerIndex := func(vnode uint32) int {
+		if serverInfo := hc.virtualNodes[vnode].serverInfo; serverInfo != nil {
+			return serverInfo.idx
+		}
+		return len(hc.servers)
+	}
+	overlapArcs(hc.ring.points, ring.points, func(oldVNode uint32, newVNode uint32, length uint64) {
+		overlap[newVNode][ownerIndex(oldVNode)] += length
+	})
+
+	owners := make([]string, numberOfVirtualNodes)
+	for i, counts := range overlap {
+		best := len(hc.servers)
+		for idx, count := range counts {
+			if count > counts[best] {
+				best = idx
+			}
+		}
+		if best < len(hc.servers) {
+			owners[i] = hc.servers[best].name
+		}
+	}
+
+	report := &ResizeReport{From: hc.numberOfVirtualNodes, To: numberOfVirtualNodes, before: before}
+	oldOwners := hc.ownerNames()
+	overlapArcs(hc.ring.points, ring.points, func(oldVNode uint32, newVNode uint32, length uint64) {
+		if oldOwners[oldVNode] != owners[newVNode] {
+			report.MovedFraction += float64(length) / math.Pow(2, 32)
+		}
+	})
+
+	change := &JournalResize{From: hc.numberOfVirtualNodes, To: numberOfVirtualNodes, Before: oldOwners, After: owners}
+	if err := hc.resize(owners); err != nil {
+		return nil, err
+	}
+	hc.journalChange(JournalEntry{Op: "resize", Args: []string{strconv.Itoa(numberOfVirtualNodes)}, Resize: change})
+
+	if report.after, err = newClusterFromState(hc.state()); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// resize replaces the virtual nodes of the cluster with len(owners) virtual
+// nodes owned by the named servers.
+func (hc *HashRingCluster) resize(owners []string) error {
+	state := hc.state()
+	state.numberOfVirtualNodes = len(owners)
+	state.owners = make([]int, len(owners))
+	for i, name := range owners {
+		state.owners[i] = -1
+		if name == "" {
+			continue
+		}
+		serverInfo := hc.findServer(name)
+		if serverInfo == nil {
+			return ErrJournalConflict
+		}
+		state.owners[i] = serverInfo.idx
+	}
+
+	cluster, err := newClusterFromState(state)
+	if err != nil {
+		return err
+	}
+	hc.restore(cluster)
+	return nil
+}
+
+// applyResize replays a resize recorded in the journal.
+func (hc *HashRingCluster) applyResize(r *JournalResize) error {
+	if hc.numberOfVirtualNodes != r.From || len(r.Before) != r.From || len(r.After) != r.To {
+		return ErrJournalConflict
+	}
+	for i, name := range hc.ownerNames() {
+		if r.Before[i] != name {
+			return ErrJournalConflict
+		}
+	}
+	return hc.resize(r.After)
+}
@@ -0,0 +1,78 @@
+package hashring
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func resizeTestCluster() *HashRingCluster {
+	cluster := NewHashRingCluster(64)
+	cluster.AddServer("server1", "0-20")
+	cluster.AddServer("server2", "21-41")
+	cluster.AddServer("server3", "42-59")
+	return cluster
+}
+
+func TestResize(t *testing.T) {
+	cluster := resizeTestCluster()
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	report, err := cluster.Resize(128)
+	if err != nil {
+		t.Fatalf("Resize failed: %v", err)
+	}
+	if cluster.numberOfVirtualNodes != 128 || len(cluster.virtualNodes) != 128 || report.From != 64 || report.To != 128 {
+		t.Fatalf("Unexpected resize %v", report)
+	}
+	total := 0
+	for _, server := range []string{"server1", "server2", "server3"} {
+		total += len(cluster.GetServerInfo(server).virtualNodes)
+	}
+	if total < 100 || total > 128 {
+		t.Errorf("Unexpected number of assigned virtual nodes %d", total)
+	}
+
+	affected := report.AffectedKeys(keys)
+	// Every new virtual node spans many old arcs, a random assignment would
+	// move two thirds of the keyspace
+	if report.MovedFraction > 0.5 {
+		t.Errorf("Too much of the keyspace moved %v", report.MovedFraction)
+	}
+	if math.Abs(report.MovedFraction-float64(len(affected))/float64(len(keys))) > 0.03 {
+		t.Errorf("MovedFraction %v, but %d of %d keys moved", report.MovedFraction, len(affected), len(keys))
+	}
+}
+
+func TestResizeUndoReplay(t *testing.T) {
+	cluster := resizeTestCluster()
+	before := owners(cluster)
+
+	cluster.Resize(100)
+	after := owners(cluster)
+	if _, err := cluster.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	expectOwners(t, cluster, before)
+	if _, err := cluster.Redo(); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	expectOwners(t, cluster, after)
+
+	// The journal starts from before the servers were added
+	start := NewHashRingCluster(64)
+	if err := start.Replay(cluster.Journal()); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	expectOwners(t, start, after)
+}
+
+func TestResizeInvalid(t *testing.T) {
+	cluster := resizeTestCluster()
+	if _, err := cluster.Resize(0); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package hashring
+
+// SlotCount is the number of slots of a Redis Cluster.
+const SlotCount = 16384
+
+var crc16Table = makeCRC16Table()
+
+// makeCRC16Table returns the table of CRC16-CCITT (XMODEM), the CRC Redis
+// Cluster uses for key slots.
+func makeCRC16Table() [256]uint16 {
+	table := [256]uint16{}
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+func crc16(key string) uint16 {
+	crc := uint16(0)
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return crc
+}
+
+// KeySlot returns the Redis Cluster slot of key, CRC16(key) mod 16384. If
+// key contains a non-empty {hashtag} only the hashtag is hashed, so keys with
+// the same hashtag share a slot.
+func KeySlot(key string) int {
+	for i := 0; i < len(key); i++ {
+		if key[i] != '{' {
+			continue
+		}
+		for j := i + 1; j < len(key); j++ {
+			if key[j] == '}' {
+				if j > i+1 {
+					key = key[i+1 : j]
+				}
+				break
+			}
+		}
+		break
+	}
+	return int(crc16(key)) % SlotCount
+}
+
+// NewSlotCluster returns a cluster in Redis Cluster slot mode. Its 16384
+// virtual nodes are the slots, keys map to them by KeySlot instead of through
+// a HashRing. Servers own slot ranges as usual, e.g. AddServer("a", "0-5460").
+// Resize is not supported in this mode.
+func NewSlotCluster() *HashRingCluster {
+	return newCluster(SlotCount, true)
+}
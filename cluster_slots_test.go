@@ -0,0 +1,89 @@
+package hashring
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	// Values from redis-cli CLUSTER KEYSLOT
+	slots := map[string]int{
+		"123456789": 0x31c3,
+		"foo":       12182,
+		"bar":       5061,
+		"":          0,
+	}
+	for key, slot := range slots {
+		if KeySlot(key) != slot {
+			t.Errorf("KeySlot(%q) expected %d but got %d", key, slot, KeySlot(key))
+		}
+	}
+
+	tags := map[string]string{
+		"{user1000}.following": "user1000",
+		"foo{bar}{zap}":        "bar",
+		"foo{{bar}}zap":        "{bar",
+		"foo{}{bar}":           "foo{}{bar}",
+		"foo{bar":              "foo{bar",
+	}
+	for key, hashed := range tags {
+		if KeySlot(key) != KeySlot(hashed) {
+			t.Errorf("KeySlot(%q) should hash %q", key, hashed)
+		}
+	}
+}
+
+func TestSlotCluster(t *testing.T) {
+	cluster := NewSlotCluster()
+	cluster.AddServer("server1", "0-5460")
+	cluster.AddServer("server2", "5461-10922")
+	cluster.AddServer("server3", "10923-16383")
+
+	if cluster.GetServer("foo") != "server3" || cluster.GetServer("bar") != "server1" {
+		t.Errorf("Unexpected servers %s %s", cluster.GetServer("foo"), cluster.GetServer("bar"))
+	}
+	if cluster.GetServer("{foo}.bar") != "server3" {
+		t.Errorf("Hashtag not used")
+	}
+
+	servers, err := cluster.GetServers("foo", 2)
+	if err != nil || servers[0] != "server3" || servers[1] != "server1" {
+		t.Errorf("Unexpected replicas %v %v", servers, err)
+	}
+
+	if _, err := cluster.Resize(32768); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestSlotClusterNextAssigned(t *testing.T) {
+	cluster := NewSlotCluster()
+	cluster.AddServer("server1", "12183-12183")
+	cluster.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedNextAssigned})
+	if server, err := cluster.GetServerE("foo"); server != "server1" || err != nil {
+		t.Errorf("Expected server1, got %s %v", server, err)
+	}
+}
+
+func TestSlotClusterPersist(t *testing.T) {
+	cluster := NewSlotCluster()
+	cluster.AddServer("server1", "0-8191")
+	cluster.AddServer("server2", "8192-16383")
+
+	data, _ := json.Marshal(cluster)
+	restored := &HashRingCluster{}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Failed to unmarshal %v", err)
+	}
+	if !restored.slots || restored.ring != nil {
+		t.Errorf("Slot mode not restored")
+	}
+	expectSameCluster(t, cluster, restored)
+
+	data, _ = cluster.MarshalBinary()
+	restored = &HashRingCluster{}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal %v", err)
+	}
+	expectSameCluster(t, cluster, restored)
+}
@@ -0,0 +1,239 @@
+package hashring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// ClusterSpec declares the topology of a cluster, see NewClusterFromSpec and
+// Reconcile. As JSON:
+//
+//	{
+//	  "virtualNodes": 64,
+//	  "servers": [
+//	    {"name": "server1", "ranges": "0-31", "weight": 2},
+//	    {"name": "server2", "ranges": "32-47,60-63"}
+//	  ],
+//	  "unassignedPolicy": {"mode": 2}
+//	}
+type ClusterSpec struct {
+	// VirtualNodes may be left out in slot mode, it is always SlotCount.
+	VirtualNodes     int               `json:"virtualNodes"`
+	Slots            bool              `json:"slots,omitempty"`
+	Servers          []ServerSpec      `json:"servers"`
+	UnassignedPolicy *UnassignedPolicy `json:"unassignedPolicy,omitempty"`
+}
+
+// ServerSpec declares a server of a ClusterSpec. Ranges is a range list like
+// AddServer takes, empty for none. Weight defaults to 1, servers without
+// virtual nodes are standbys and need weight 0, see Validate.
+type ServerSpec struct {
+	Name   string   `json:"name"`
+	Ranges string   `json:"ranges,omitempty"`
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// ParseClusterSpec parses a ClusterSpec from JSON. Unknown fields are
+// rejected, so typos in a config file do not go unnoticed.
+func ParseClusterSpec(data []byte) (*ClusterSpec, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	spec := &ClusterSpec{}
+	if err := decoder.Decode(spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// LoadClusterSpec reads a ClusterSpec from a JSON file.
+func LoadClusterSpec(path string) (*ClusterSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseClusterSpec(data)
+}
+
+// state returns the cluster state declared by spec, or a *ValidationError
+// listing every problem of the spec.
+func (spec *ClusterSpec) state() (clusterState, error) {
+	state := clusterState{
+		numberOfVirtualNodes: spec.VirtualNodes,
+		slots:                spec.Slots,
+		servers:              make([]string, len(spec.Servers)),
+		weights:              make([]float64, len(spec.Servers)),
+	}
+	if spec.UnassignedPolicy != nil {
+		state.unassignedPolicy = *spec.UnassignedPolicy
+	}
+
+	problems := []string{}
+	if spec.Slots && spec.VirtualNodes == 0 {
+		state.numberOfVirtualNodes = SlotCount
+	}
+	if spec.Slots && state.numberOfVirtualNodes != SlotCount {
+		problems = append(problems, fmt.Sprintf("slot mode needs %d virtual nodes", SlotCount))
+	}
+	if state.numberOfVirtualNodes <= 0 {
+		problems = append(problems, "no virtual nodes")
+	}
+	state.owners = make([]int, state.numberOfVirtualNodes)
+	for i := range state.owners {
+		state.owners[i] = -1
+	}
+
+	names := map[string]bool{}
+	for i, server := range spec.Servers {
+		state.servers[i] = server.Name
+		state.weights[i] = 1
+		if server.Name == "" {
+			problems = append(problems, fmt.Sprintf("server %d has no name", i))
+		} else if names[server.Name] {
+			problems = append(problems, fmt.Sprintf("duplicate server %s", server.Name))
+		}
+		names[server.Name] = true
+
+		if server.Weight != nil {
+			state.weights[i] = *server.Weight
+			if !validWeight(*server.Weight) {
+				problems = append(problems, fmt.Sprintf("server %s has weight %v", server.Name, *server.Weight))
+			}
+		}
+
+		if server.Ranges == "" {
+			if state.weights[i] != 0 {
+				problems = append(problems, fmt.Sprintf("server %s has no virtual nodes but weight %v", server.Name, state.weights[i]))
+			}
+			continue
+		}
+		ranges, err := parseRanges(server.Ranges)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("server %s has invalid ranges %q", server.Name, server.Ranges))
+			continue
+		}
+		for _, vr := range ranges {
+			if vr.start < 0 || vr.end >= len(state.owners) {
+				problems = append(problems, fmt.Sprintf("server %s has virtual nodes %d-%d out of range", server.Name, vr.start, vr.end))
+				continue
+			}
+			// One problem for every other server the range overlaps
+			overlaps := map[int]bool{}
+			for vnode := vr.start; vnode <= vr.end; vnode++ {
+				owner := state.owners[vnode]
+				switch {
+				case owner == -1 || owner == i:
+					state.owners[vnode] = i
+				case !overlaps[owner]:
+					overlaps[owner] = true
+					problems = append(problems, fmt.Sprintf("virtual nodes %d-%d of %s overlap %s", vr.start, vr.end, server.Name, spec.Servers[owner].Name))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return state, &ValidationError{Problems: problems}
+	}
+	return state, nil
+}
+
+// NewClusterFromSpec builds the cluster declared by spec.
+func NewClusterFromSpec(spec *ClusterSpec) (*HashRingCluster, error) {
+	state, err := spec.state()
+	if err != nil {
+		return nil, err
+	}
+	return newClusterFromState(state)
+}
+
+// Spec returns the declaration of the current topology of the cluster.
+func (hc *HashRingCluster) Spec() *ClusterSpec {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	spec := &ClusterSpec{
+		VirtualNodes: hc.numberOfVirtualNodes,
+		Slots:        hc.slots,
+		Servers:      make([]ServerSpec, len(hc.servers)),
+	}
+	if hc.unassignedPolicy != (UnassignedPolicy{}) {
+		policy := hc.unassignedPolicy
+		spec.UnassignedPolicy = &policy
+	}
+	for i, server := range hc.servers {
+		spec.Servers[i] = ServerSpec{Name: server.name, Ranges: formatVNodes(sortedVNodes(server))}
+		if server.weight != 1 {
+			weight := server.weight
+			spec.Servers[i].Weight = &weight
+		}
+	}
+	return spec
+}
+
+// Reconcile plans the changes that turn the cluster into the one declared
+// by spec: servers missing from the cluster are created, virtual nodes move
+// to their declared owner, servers missing from spec are retired and weights
+// and the UnassignedPolicy are updated. The number of virtual nodes and the
+// mode must already match, see Resize.
+func (hc *HashRingCluster) Reconcile(spec *ClusterSpec) (*Plan, error) {
+	state, err := spec.state()
+	if err != nil {
+		return nil, err
+	}
+
+	return hc.plan(func(cluster *HashRingCluster) error {
+		if cluster.numberOfVirtualNodes != state.numberOfVirtualNodes || cluster.slots != state.slots {
+			return ErrInvalidInput
+		}
+		if spec.UnassignedPolicy != nil && !validPolicy(state.unassignedPolicy) {
+			return ErrInvalidInput
+		}
+
+		_, err := cluster.record("reconcile", nil, func() ([]VNodeMove, error) {
+			if spec.UnassignedPolicy != nil {
+				cluster.unassignedPolicy = state.unassignedPolicy
+			}
+			return cluster.reconcile(state)
+		})
+		return err
+	})
+}
+
+// reconcile makes the cluster match state, which has the same virtual nodes.
+// Nothing changes if a weight of state is invalid.
+func (hc *HashRingCluster) reconcile(state clusterState) ([]VNodeMove, error) {
+	for _, weight := range state.weights {
+		if !validWeight(weight) {
+			return nil, ErrInvalidInput
+		}
+	}
+
+	servers := make([]*ServerInfo, len(state.servers))
+	for i, name := range state.servers {
+		servers[i] = hc.findServer(name)
+		if servers[i] == nil {
+			servers[i] = hc.newServer(name)
+		}
+		servers[i].weight = state.weights[i]
+	}
+
+	moves := []VNodeMove{}
+	for i, owner := range state.owners {
+		var server *ServerInfo
+		if owner >= 0 {
+			server = servers[owner]
+		}
+		if move := hc.assign(i, server); move.From != move.To {
+			moves = append(moves, move)
+		}
+	}
+
+	for _, server := range append([]*ServerInfo{}, hc.servers...) {
+		if !contains(state.servers, server.name) {
+			hc.retireServer(server)
+		}
+	}
+	return moves, nil
+}
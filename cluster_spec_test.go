@@ -0,0 +1,182 @@
+package hashring
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSpec = `{
+  "virtualNodes": 64,
+  "servers": [
+    {"name": "server1", "ranges": "0-31", "weight": 2},
+    {"name": "server2", "ranges": "32-47,60-63"}
+  ],
+  "unassignedPolicy": {"mode": 2}
+}`
+
+func TestNewClusterFromSpec(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "hashring")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cluster.json")
+	ioutil.WriteFile(path, []byte(testSpec), 0644)
+
+	spec, err := LoadClusterSpec(path)
+	if err != nil {
+		t.Fatalf("LoadClusterSpec failed: %v", err)
+	}
+	cluster, err := NewClusterFromSpec(spec)
+	if err != nil {
+		t.Fatalf("NewClusterFromSpec failed: %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 32)
+	expectVNodeCount(t, cluster, "server2", 20)
+	if cluster.findServer("server1").weight != 2 || cluster.unassignedPolicy.Mode != UnassignedNextAssigned {
+		t.Errorf("Weight or policy not set")
+	}
+
+	data, _ := json.Marshal(cluster.Spec())
+	roundTrip, err := ParseClusterSpec(data)
+	if err != nil {
+		t.Fatalf("ParseClusterSpec failed: %v", err)
+	}
+	restored, _ := NewClusterFromSpec(roundTrip)
+	expectSameCluster(t, cluster, restored)
+}
+
+func TestClusterSpecProblems(t *testing.T) {
+	spec, err := ParseClusterSpec([]byte(`{
+		"virtualNodes": 10,
+		"servers": [
+			{"name": "server1", "ranges": "0-5"},
+			{"name": "server1", "ranges": "3-9,5-200000000"},
+			{"name": "", "ranges": "x"}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseClusterSpec failed: %v", err)
+	}
+	_, err = NewClusterFromSpec(spec)
+	verr, ok := err.(*ValidationError)
+	// Duplicate, overlap at 3-5, 5-200000000 out of range, no name, bad
+	// ranges
+	if !ok || len(verr.Problems) != 5 {
+		t.Errorf("Unexpected problems %v", err)
+	}
+
+	if _, err := ParseClusterSpec([]byte(`{"virtualNode": 10}`)); err == nil {
+		t.Errorf("Unknown field accepted")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	cluster := NewHashRingCluster(64)
+	cluster.AddServer("server1", "0-40")
+	cluster.AddServer("server3", "41-63")
+
+	spec, _ := ParseClusterSpec([]byte(testSpec))
+	plan, err := cluster.Reconcile(spec)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	// 32-40 to server2, 41-47,60-63 to server2, 48-59 unassigned
+	if len(plan.Moves) != 32 || len(plan.Created) != 1 || len(plan.Retired) != 1 {
+		t.Errorf("Unexpected plan %v", plan)
+	}
+	if plan.Weights["server1"] != 2 || len(plan.Weights) != 1 || plan.UnassignedPolicy == nil {
+		t.Errorf("Unexpected weights or policy %v %v", plan.Weights, plan.UnassignedPolicy)
+	}
+
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	expected, _ := NewClusterFromSpec(spec)
+	expectSameCluster(t, expected, cluster)
+
+	plan, _ = cluster.Reconcile(spec)
+	if len(plan.Moves) != 0 || len(plan.Weights) != 0 || plan.UnassignedPolicy != nil {
+		t.Errorf("Reconciled cluster should need no changes %v", plan)
+	}
+
+	spec.VirtualNodes = 128
+	if _, err := cluster.Reconcile(spec); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestReconcileInvalidWeight(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-9")
+
+	for _, weight := range []float64{math.Inf(1), math.NaN(), -1} {
+		spec := &ClusterSpec{VirtualNodes: 10, Servers: []ServerSpec{{Name: "server1", Ranges: "0-9", Weight: &weight}}}
+		if _, err := cluster.Reconcile(spec); err == nil {
+			t.Errorf("Reconcile accepted weight %v", weight)
+		}
+		if _, err := NewClusterFromSpec(spec); err == nil {
+			t.Errorf("NewClusterFromSpec accepted weight %v", weight)
+		}
+
+		state := cluster.state()
+		state.weights[0] = weight
+		if _, err := cluster.reconcile(state); err != ErrInvalidInput {
+			t.Errorf("Expected ErrInvalidInput for weight %v, got %v", weight, err)
+		}
+	}
+	if cluster.findServer("server1").weight != 1 {
+		t.Errorf("Invalid weight set")
+	}
+	if _, err := cluster.Rebalance(true); err != nil {
+		t.Errorf("Rebalance failed: %v", err)
+	}
+}
+
+func TestReconcileStaleAfterPolicyChange(t *testing.T) {
+	cluster := NewHashRingCluster(64)
+	spec, _ := ParseClusterSpec([]byte(testSpec))
+	plan, err := cluster.Reconcile(spec)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	policy := UnassignedPolicy{Mode: UnassignedDefault, Server: "server9"}
+	cluster.SetUnassignedPolicy(policy)
+	if err := plan.Apply(); err != ErrStalePlan {
+		t.Errorf("Expected ErrStalePlan, got %v", err)
+	}
+	if cluster.unassignedPolicy != policy {
+		t.Errorf("Policy overwritten %v", cluster.unassignedPolicy)
+	}
+}
+
+func TestReconcileReplay(t *testing.T) {
+	cluster := NewHashRingCluster(64)
+	cluster.AddServer("server1", "0-40")
+	spec, _ := ParseClusterSpec([]byte(testSpec))
+	plan, _ := cluster.Reconcile(spec)
+	if err := plan.Apply(); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	cluster.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedDefault, Server: "server2"})
+
+	replayed := NewHashRingCluster(64)
+	if err := replayed.Replay(cluster.Journal()); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	expectSameCluster(t, cluster, replayed)
+	if replayed.unassignedPolicy != cluster.unassignedPolicy {
+		t.Errorf("Replay did not rebuild the policy %v", replayed.unassignedPolicy)
+	}
+
+	cluster.Undo()
+	if cluster.unassignedPolicy != *spec.UnassignedPolicy {
+		t.Errorf("Undo did not restore the policy %v", cluster.unassignedPolicy)
+	}
+	cluster.Undo()
+	if cluster.unassignedPolicy != (UnassignedPolicy{}) || cluster.findServer("server1").weight != 1 {
+		t.Errorf("Undo did not revert the reconcile %v", cluster.unassignedPolicy)
+	}
+}
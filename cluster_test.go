@@ -1,6 +1,7 @@
 package hashring
 
 import (
+	"fmt"
 	"strconv"
 	"testing"
 )
@@ -222,3 +223,587 @@ func TestSplit(t *testing.T) {
 		t.Logf("%d: %s->%s", i, found[i], afterSplit[i])
 	}
 }
+
+func expectVNodeCount(t *testing.T, cluster *HashRingCluster, server string, count int) {
+	// The live server, GetServerInfo returns a copy
+	serverInfo := cluster.findServer(server)
+	if serverInfo == nil {
+		t.Errorf("Server %s not found", server)
+		return
+	}
+	if len(serverInfo.virtualNodes) != count {
+		t.Errorf("Server %s has %d virtual nodes, expected %d", server, len(serverInfo.virtualNodes), count)
+	}
+	for _, vn := range serverInfo.virtualNodes {
+		if vn.serverInfo != serverInfo {
+			t.Errorf("virtual node %d has wrong server for %s", vn.idx, server)
+		}
+		if cluster.virtualToServerMapping[vn.name] != serverInfo {
+			t.Errorf("virtualToServerMapping of %d not pointing to %s", vn.idx, server)
+		}
+	}
+}
+
+func TestRemoveServerUnassign(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "50-99")
+
+	moves, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveUnassign})
+	if err != nil {
+		t.Fatalf("Failed to remove server %v", err)
+	}
+	if len(moves) != 50 || moves[0] != (VNodeMove{VNode: 0, From: "server1", To: ""}) {
+		t.Errorf("Unexpected moves %v", moves)
+	}
+
+	if cluster.GetServerInfo("server1") != nil {
+		t.Error("server1 still in cluster")
+	}
+	if len(cluster.servers) != 1 || cluster.servers[0].idx != 0 {
+		t.Error("servers not reindexed")
+	}
+	for i := 0; i < 50; i++ {
+		if cluster.virtualNodes[i].serverInfo != nil {
+			t.Errorf("Virtual node %d still assigned", i)
+		}
+		if _, ok := cluster.virtualToServerMapping[strconv.Itoa(i)]; ok {
+			t.Errorf("Virtual node %d still mapped", i)
+		}
+	}
+	expectVNodeCount(t, cluster, "server2", 50)
+}
+
+func TestRemoveServerSpread(t *testing.T) {
+	cluster := NewHashRingCluster(90)
+	cluster.AddServer("server1", "0-29")
+	cluster.AddServer("server2", "30-59")
+	cluster.AddServer("server3", "60-79")
+	cluster.AddServer("server4", "80-89")
+
+	moves, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveSpread})
+	if err != nil {
+		t.Fatalf("Failed to remove server %v", err)
+	}
+	if len(moves) != 30 {
+		t.Errorf("Expected 30 moves but got %d", len(moves))
+	}
+	expectVNodeCount(t, cluster, "server2", 30)
+	expectVNodeCount(t, cluster, "server3", 30)
+	expectVNodeCount(t, cluster, "server4", 30)
+}
+
+func TestRemoveServerSpreadWeights(t *testing.T) {
+	cluster := NewHashRingCluster(90)
+	cluster.AddServer("server1", "0-59")
+	cluster.AddServer("server2", "60-69")
+	cluster.AddServer("server3", "70-89")
+	cluster.AddServer("server4", "60")
+	cluster.SetServerWeight("server3", 2)
+	cluster.SetServerWeight("server4", 0)
+
+	if _, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveSpread}); err != nil {
+		t.Fatalf("Failed to remove server %v", err)
+	}
+	expectVNodeCount(t, cluster, "server2", 30)
+	expectVNodeCount(t, cluster, "server3", 59)
+	expectVNodeCount(t, cluster, "server4", 1)
+
+	cluster.SetServerWeight("server2", 0)
+	cluster.SetServerWeight("server3", 0)
+	if _, err := cluster.RemoveServer("server4", RemovePolicy{Mode: RemoveSpread}); err != ErrNoServers {
+		t.Errorf("Expected ErrNoServers without weighted servers, got %v", err)
+	}
+}
+
+func TestRemoveServerToSuccessor(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "50-99")
+
+	before := []string{}
+	for i := 0; i < 1000; i++ {
+		before = append(before, cluster.GetServer(strconv.Itoa(i)))
+	}
+
+	moves, err := cluster.RemoveServer("server2", RemovePolicy{Mode: RemoveToSuccessor, Successor: "server1"})
+	if err != nil {
+		t.Fatalf("Failed to remove server %v", err)
+	}
+	for _, move := range moves {
+		if move.From != "server2" || move.To != "server1" {
+			t.Errorf("Unexpected move %v", move)
+		}
+	}
+	expectVNodeCount(t, cluster, "server1", 100)
+
+	for i := 0; i < 1000; i++ {
+		if server := cluster.GetServer(strconv.Itoa(i)); server != "server1" {
+			t.Errorf("Key %d moved to %s, was %s", i, server, before[i])
+		}
+	}
+}
+
+func TestRemoveServerErrors(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-99")
+
+	if _, err := cluster.RemoveServer("server2", RemovePolicy{}); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound but got %v", err)
+	}
+	if _, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveToSuccessor, Successor: "server2"}); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound but got %v", err)
+	}
+	if _, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveToSuccessor, Successor: "server1"}); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+	if _, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveSpread}); err != ErrNoServers {
+		t.Errorf("Expected ErrNoServers but got %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 100)
+}
+
+func TestRemoveEmptyServer(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-99")
+	cluster.AddServer("server2", "0-99")
+
+	moves, err := cluster.RemoveServer("server1", RemovePolicy{Mode: RemoveSpread})
+	if err != nil || len(moves) != 0 {
+		t.Errorf("Expected no moves but got %v, %v", moves, err)
+	}
+	if len(cluster.servers) != 1 {
+		t.Errorf("Expected 1 server but got %d", len(cluster.servers))
+	}
+}
+
+func TestMerge(t *testing.T) {
+	cluster := NewHashRingCluster(150)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "50-99")
+	cluster.AddServer("server3", "100-149")
+
+	before := []string{}
+	for i := 0; i < 1000; i++ {
+		before = append(before, cluster.GetServer(strconv.Itoa(i)))
+	}
+
+	moved, err := cluster.Merge("server2", "server3")
+	if err != nil {
+		t.Fatalf("Failed to merge %v", err)
+	}
+	if moved != 50 {
+		t.Errorf("Expected 50 moved virtual nodes but got %d", moved)
+	}
+	if cluster.GetServerInfo("server2") != nil {
+		t.Error("server2 not retired")
+	}
+	expectVNodeCount(t, cluster, "server1", 50)
+	expectVNodeCount(t, cluster, "server3", 100)
+
+	for i := 0; i < 1000; i++ {
+		after := cluster.GetServer(strconv.Itoa(i))
+		if before[i] == "server2" && after != "server3" {
+			t.Errorf("Key %d of server2 moved to %s", i, after)
+		}
+		if before[i] != "server2" && after != before[i] {
+			t.Errorf("Key %d moved from %s to %s", i, before[i], after)
+		}
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "50-99")
+
+	if _, err := cluster.Merge("server1", "server3"); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound but got %v", err)
+	}
+	if _, err := cluster.Merge("server3", "server1"); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound but got %v", err)
+	}
+	if _, err := cluster.Merge("server1", "server1"); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 50)
+	expectVNodeCount(t, cluster, "server2", 50)
+}
+
+func TestReplaceServer(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-9,20-29,90")
+	cluster.AddServer("server2", "10-19")
+	cluster.SetServerWeight("server1", 2)
+	before := sortedVNodes(cluster.GetServerInfo("server1"))
+
+	if err := cluster.ReplaceServer("server1", "server1b"); err != nil {
+		t.Fatalf("ReplaceServer failed: %v", err)
+	}
+	if cluster.GetServerInfo("server1") != nil {
+		t.Errorf("server1 should be retired")
+	}
+	server := cluster.GetServerInfo("server1b")
+	if fmt.Sprint(sortedVNodes(server)) != fmt.Sprint(before) {
+		t.Errorf("Expected %v but got %v", before, sortedVNodes(server))
+	}
+	if server.weight != 2 {
+		t.Errorf("Weight not carried over %v", server.weight)
+	}
+	expectVNodeCount(t, cluster, "server2", 10)
+
+	if err := cluster.ReplaceServer("server1", "server3"); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound but got %v", err)
+	}
+	if err := cluster.ReplaceServer("server1b", "server2"); err != ErrServerExists {
+		t.Errorf("Expected ErrServerExists but got %v", err)
+	}
+	if err := cluster.ReplaceServer("server1b", ""); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+
+	if _, err := cluster.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", len(before))
+}
+
+func TestReplaceServerMigrations(t *testing.T) {
+	cluster := NewHashRingCluster(20)
+	cluster.AddServer("server1", "0-9")
+	cluster.AddServer("server2", "10-19")
+	cluster.BeginMigration("server2", 3)
+	cluster.BeginMigration("server1b", 4)
+	cluster.BeginMigration("server1", 12)
+
+	if err := cluster.ReplaceServer("server1", "server1b"); err != nil {
+		t.Fatalf("ReplaceServer failed: %v", err)
+	}
+	if target, _ := cluster.MigrationTarget(3); target != "server2" {
+		t.Errorf("Outgoing migration lost, target %q", target)
+	}
+	if cluster.VNodeState(3, "server1b") != VNodeMigrating {
+		t.Errorf("server1b should migrate virtual node 3")
+	}
+	// server1b owns virtual node 4 already
+	if _, ok := cluster.MigrationTarget(4); ok {
+		t.Errorf("Migration to the owner should end")
+	}
+	if target, _ := cluster.MigrationTarget(12); target != "server1b" {
+		t.Errorf("Incoming migration not moved, target %q", target)
+	}
+	if err := cluster.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+}
+
+func TestSplitServerNotStartingAtZero(t *testing.T) {
+	cluster := NewHashRingCluster(150)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "50-99")
+	cluster.AddServer("server3", "100-149")
+
+	if err := cluster.Split("server3", "server3a"); err != nil {
+		t.Fatalf("Failed to split %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 50)
+	expectVNodeCount(t, cluster, "server2", 50)
+	expectVNodeCount(t, cluster, "server3", 25)
+	expectVNodeCount(t, cluster, "server3a", 25)
+
+	for _, vn := range cluster.GetServerInfo("server3a").virtualNodes {
+		if vn.idx < 125 {
+			t.Errorf("server3a got virtual node %d", vn.idx)
+		}
+	}
+}
+
+func TestSplitFraction(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-99")
+
+	moves, err := cluster.SplitFraction("server1", "server2", 0.25)
+	if err != nil {
+		t.Fatalf("Failed to split %v", err)
+	}
+	if len(moves) != 25 || moves[0] != (VNodeMove{VNode: 75, From: "server1", To: "server2"}) {
+		t.Errorf("Unexpected moves %v", moves)
+	}
+	expectVNodeCount(t, cluster, "server1", 75)
+	expectVNodeCount(t, cluster, "server2", 25)
+
+	for _, fraction := range []float64{0.9, 0.7, 0.3} {
+		cluster := NewHashRingCluster(10)
+		cluster.AddServer("server1", "0-9")
+		moves, err := cluster.SplitFraction("server1", "server2", fraction)
+		if err != nil {
+			t.Fatalf("Failed to split %v: %v", fraction, err)
+		}
+		expected := int(fraction*10 + 0.5)
+		if len(moves) != expected {
+			t.Errorf("Split %v moved %d virtual nodes, expected %d", fraction, len(moves), expected)
+		}
+		expectVNodeCount(t, cluster, "server1", 10-expected)
+	}
+}
+
+func TestSplitN(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-9")
+	cluster.AddServer("server2", "10-99")
+
+	moves, err := cluster.SplitN("server2", "server2a", "server2b")
+	if err != nil {
+		t.Fatalf("Failed to split %v", err)
+	}
+	if len(moves) != 60 {
+		t.Errorf("Expected 60 moves but got %d", len(moves))
+	}
+	expectVNodeCount(t, cluster, "server1", 10)
+	expectVNodeCount(t, cluster, "server2", 30)
+	expectVNodeCount(t, cluster, "server2a", 30)
+	expectVNodeCount(t, cluster, "server2b", 30)
+}
+
+func TestSplitErrors(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-0")
+	cluster.AddServer("server2", "1-99")
+
+	if err := cluster.Split("server3", "server3a"); err != ErrServerNotFound {
+		t.Errorf("Expected ErrServerNotFound but got %v", err)
+	}
+	if err := cluster.Split("server2", "server1"); err != ErrServerExists {
+		t.Errorf("Expected ErrServerExists but got %v", err)
+	}
+	if err := cluster.Split("server1", "server1a"); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput for a single virtual node but got %v", err)
+	}
+	if _, err := cluster.SplitFraction("server2", "server2a", 1); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput for fraction 1 but got %v", err)
+	}
+	if _, err := cluster.SplitN("server2", "server2a", "server2a"); err != ErrServerExists {
+		t.Errorf("Expected ErrServerExists for duplicate names but got %v", err)
+	}
+	if _, err := cluster.SplitN("server2"); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput without new servers but got %v", err)
+	}
+
+	if len(cluster.servers) != 2 {
+		t.Errorf("Failed splits added servers %d", len(cluster.servers))
+	}
+	expectVNodeCount(t, cluster, "server1", 1)
+	expectVNodeCount(t, cluster, "server2", 99)
+}
+
+func TestParseRangeList(t *testing.T) {
+	vnodes, err := parseRangeList("0-3, 7 ,12 - 13", 14)
+	expected := []int{0, 1, 2, 3, 7, 12, 13}
+	if err != nil || len(vnodes) != len(expected) {
+		t.Fatalf("Failed to parse range list %v, %v", vnodes, err)
+	}
+	for i := range expected {
+		if vnodes[i] != expected[i] {
+			t.Errorf("Failed to parse range list %v expected %v", vnodes, expected)
+		}
+	}
+
+	for _, r := range []string{"", "1,", "a", "3-1", "1-2-3", "0-3,x", "0-14", "-1", "3,14"} {
+		if _, err := parseRangeList(r, 14); err == nil {
+			t.Errorf("Expected an error parsing %q", r)
+		}
+	}
+
+	// Out of range ranges are rejected before they are expanded
+	cluster := NewHashRingCluster(10)
+	if err := cluster.AddServer("server1", "0-2000000000"); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestAddServerRangeList(t *testing.T) {
+	cluster := NewHashRingCluster(20)
+	if err := cluster.AddServer("server1", "0-19"); err != nil {
+		t.Fatalf("Failed to add server %v", err)
+	}
+	if err := cluster.AddServer("server2", "0-3,7,12-15"); err != nil {
+		t.Fatalf("Failed to add server %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 11)
+	expectVNodeCount(t, cluster, "server2", 9)
+
+	for _, i := range []int{0, 3, 7, 12, 15} {
+		if cluster.virtualNodes[i].serverInfo.name != "server2" {
+			t.Errorf("Virtual node %d not assigned to server2", i)
+		}
+	}
+}
+
+func TestAddServerExistingName(t *testing.T) {
+	cluster := NewHashRingCluster(20)
+	cluster.AddServer("server1", "0-9")
+	cluster.AddServer("server1", "15-19")
+
+	if len(cluster.servers) != 1 {
+		t.Errorf("Expected 1 server but got %d", len(cluster.servers))
+	}
+	expectVNodeCount(t, cluster, "server1", 15)
+}
+
+func TestAssignVNodesIsAtomic(t *testing.T) {
+	cluster := NewHashRingCluster(20)
+	cluster.AddServer("server1", "0-19")
+
+	if err := cluster.AssignVNodes("server2", []int{1, 2, 20}); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+	if err := cluster.AssignVNodes("server2", []int{}); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+	if err := cluster.AddServer("server2", "1-2,30"); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+	if cluster.GetServerInfo("server2") != nil {
+		t.Error("Failed assignment created server2")
+	}
+	expectVNodeCount(t, cluster, "server1", 20)
+
+	if err := cluster.AssignVNodes("server2", []int{19, 4, 4}); err != nil {
+		t.Errorf("Failed to assign virtual nodes %v", err)
+	}
+	expectVNodeCount(t, cluster, "server1", 18)
+	expectVNodeCount(t, cluster, "server2", 2)
+}
+
+func TestGetServerE(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+
+	unassigned := 0
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		server, err := cluster.GetServerE(key)
+		if err == ErrUnassignedVNode {
+			unassigned++
+			if server != "" {
+				t.Errorf("Expected no server for %s but got %s", key, server)
+			}
+			if cluster.GetServer(key) != BlackHole {
+				t.Errorf("GetServer(%s) expected BlackHole", key)
+			}
+		} else if err != nil || server != "server1" {
+			t.Errorf("GetServerE(%s) expected server1 but got %s, %v", key, server, err)
+		}
+	}
+	if unassigned == 0 || unassigned == 1000 {
+		t.Errorf("Expected some unassigned keys but got %d", unassigned)
+	}
+
+	cluster.AddServer(BlackHole, "50-99")
+	for i := 0; i < 1000; i++ {
+		if _, err := cluster.GetServerE(strconv.Itoa(i)); err != nil {
+			t.Errorf("Server named BlackHole not reported as a server %v", err)
+		}
+	}
+}
+
+func TestUnassignedPolicyDefault(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+	if err := cluster.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedDefault, Server: "fallback"}); err != nil {
+		t.Fatalf("Failed to set policy %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		server, err := cluster.GetServerE(key)
+		vnode, _ := cluster.ring.GetNode(key)
+		expected := "fallback"
+		if _, ok := cluster.virtualToServerMapping[vnode]; ok {
+			expected = "server1"
+		}
+		if err != nil || server != expected {
+			t.Errorf("GetServerE(%s) expected %s but got %s, %v", key, expected, server, err)
+		}
+	}
+
+	if cluster.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedDefault}) != ErrInvalidInput {
+		t.Error("Default policy without a server accepted")
+	}
+}
+
+func TestUnassignedPolicyNextAssigned(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-9")
+	cluster.AddServer("server2", "10-19")
+	cluster.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedNextAssigned})
+
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		server, err := cluster.GetServerE(key)
+		if err != nil {
+			t.Fatalf("GetServerE(%s) failed %v", key, err)
+		}
+
+		expected := ""
+		pos, _ := cluster.ring.GetNodePos(key)
+		cluster.ring.Walk(pos, func(vnode string) bool {
+			if serverInfo, ok := cluster.virtualToServerMapping[vnode]; ok {
+				expected = serverInfo.name
+				return false
+			}
+			return true
+		})
+		if server != expected {
+			t.Errorf("GetServerE(%s) expected %s but got %s", key, expected, server)
+		}
+	}
+
+	empty := NewHashRingCluster(10)
+	empty.SetUnassignedPolicy(UnassignedPolicy{Mode: UnassignedNextAssigned})
+	if _, err := empty.GetServerE("test"); err != ErrUnassignedVNode {
+		t.Errorf("Expected ErrUnassignedVNode but got %v", err)
+	}
+}
+
+func TestGetServers(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-24")
+	cluster.AddServer("server2", "25-49")
+	cluster.AddServer("server3", "50-74")
+
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		servers, err := cluster.GetServers(key, 3)
+		if err != nil {
+			t.Fatalf("GetServers(%s, 3) failed %v", key, err)
+		}
+
+		seen := map[string]bool{}
+		for _, server := range servers {
+			if seen[server] {
+				t.Errorf("GetServers(%s, 3) returned %s twice", key, server)
+			}
+			seen[server] = true
+		}
+
+		if server, err := cluster.GetServerE(key); err == nil && servers[0] != server {
+			t.Errorf("GetServers(%s, 3) expected %s first but got %v", key, server, servers)
+		}
+
+		again, _ := cluster.GetServers(key, 2)
+		if again[0] != servers[0] || again[1] != servers[1] {
+			t.Errorf("GetServers(%s, 2) not a prefix %v of %v", key, again, servers)
+		}
+	}
+
+	if _, err := cluster.GetServers("test", 4); err != ErrNotEnoughServers {
+		t.Errorf("Expected ErrNotEnoughServers but got %v", err)
+	}
+	if _, err := cluster.GetServers("test", 0); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput but got %v", err)
+	}
+	if _, err := NewHashRingCluster(0).GetServers("test", 1); err != ErrNotEnoughServers {
+		t.Errorf("Expected ErrNotEnoughServers on an empty ring but got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package hashring
+
+// Name returns the name of the server.
+func (s *ServerInfo) Name() string {
+	return s.name
+}
+
+// Index returns the position of the server in the cluster.
+func (s *ServerInfo) Index() int {
+	return s.idx
+}
+
+// Weight returns the capacity weight of the server.
+func (s *ServerInfo) Weight() float64 {
+	return s.weight
+}
+
+// VirtualNodes returns the indices of the virtual nodes the server owns in
+// ascending order.
+func (s *ServerInfo) VirtualNodes() []int {
+	return sortedVNodes(s)
+}
+
+// Name returns the name of the virtual node on the ring.
+func (v *VirtualNodeInfo) Name() string {
+	return v.name
+}
+
+// Index returns the index of the virtual node.
+func (v *VirtualNodeInfo) Index() int {
+	return v.idx
+}
+
+// Server returns the name of the owner of the virtual node, "" for none.
+func (v *VirtualNodeInfo) Server() string {
+	if v.serverInfo == nil {
+		return ""
+	}
+	return v.serverInfo.name
+}
+
+// NumVirtualNodes returns the number of virtual nodes of the cluster.
+func (hc *HashRingCluster) NumVirtualNodes() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.numberOfVirtualNodes
+}
+
+// Servers returns the names of the servers in index order.
+func (hc *HashRingCluster) Servers() []string {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.serverNames()
+}
+
+// GetVirtualNodeInfo returns a copy of virtual node i, or nil if there is
+// none. Later changes of the cluster do not affect it.
+func (hc *HashRingCluster) GetVirtualNodeInfo(i int) *VirtualNodeInfo {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if i < 0 || i >= hc.numberOfVirtualNodes {
+		return nil
+	}
+	vnode := hc.virtualNodes[i]
+	if vnode.serverInfo == nil {
+		return &VirtualNodeInfo{name: vnode.name, idx: vnode.idx}
+	}
+	for _, v := range vnode.serverInfo.snapshot().virtualNodes {
+		if v.idx == i {
+			return v
+		}
+	}
+	return nil
+}
+
+// Owner returns the server of virtual node i.
+func (hc *HashRingCluster) Owner(i int) (string, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if i < 0 || i >= hc.numberOfVirtualNodes {
+		return "", ErrInvalidInput
+	}
+	if hc.virtualNodes[i].serverInfo == nil {
+		return "", ErrUnassignedVNode
+	}
+	return hc.virtualNodes[i].serverInfo.name, nil
+}
+
+// Topology is a snapshot of the assignment of a cluster.
+type Topology struct {
+	VirtualNodes int              `json:"virtualNodes"`
+	Slots        bool             `json:"slots,omitempty"`
+	Servers      []ServerTopology `json:"servers"`
+	// Owners holds the server of every virtual node, "" for none.
+	Owners     []string `json:"owners"`
+	Unassigned []int    `json:"unassigned"`
+}
+
+// ServerTopology is a server in a Topology.
+type ServerTopology struct {
+	Name         string  `json:"name"`
+	Weight       float64 `json:"weight"`
+	VirtualNodes []int   `json:"vnodes"`
+}
+
+// Topology returns a snapshot of the servers and virtual nodes of the
+// cluster, later changes of the cluster do not affect it.
+func (hc *HashRingCluster) Topology() Topology {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	topology := Topology{
+		VirtualNodes: hc.numberOfVirtualNodes,
+		Slots:        hc.slots,
+		Servers:      make([]ServerTopology, len(hc.servers)),
+		Owners:       hc.ownerNames(),
+		Unassigned:   []int{},
+	}
+	for i, server := range hc.servers {
+		topology.Servers[i] = ServerTopology{Name: server.name, Weight: server.weight, VirtualNodes: sortedVNodes(server)}
+	}
+	for i, owner := range topology.Owners {
+		if owner == "" {
+			topology.Unassigned = append(topology.Unassigned, i)
+		}
+	}
+	return topology
+}
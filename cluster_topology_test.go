@@ -0,0 +1,66 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestServerInfoAccessors(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "5-6,0")
+	cluster.AddServer("server2", "1")
+
+	server := cluster.GetServerInfo("server1")
+	if server.Name() != "server1" || server.Index() != 0 || server.Weight() != 1 {
+		t.Errorf("Unexpected server %s %d %v", server.Name(), server.Index(), server.Weight())
+	}
+	if fmt.Sprint(server.VirtualNodes()) != "[0 5 6]" {
+		t.Errorf("Unexpected virtual nodes %v", server.VirtualNodes())
+	}
+
+	vnode := cluster.GetVirtualNodeInfo(1)
+	if vnode.Name() != "1" || vnode.Index() != 1 || vnode.Server() != "server2" {
+		t.Errorf("Unexpected virtual node %s %d %s", vnode.Name(), vnode.Index(), vnode.Server())
+	}
+	if cluster.GetVirtualNodeInfo(2).Server() != "" || cluster.GetVirtualNodeInfo(10) != nil {
+		t.Errorf("Unexpected virtual nodes")
+	}
+
+	// Both are copies
+	cluster.AddServer("server3", "0-9")
+	if len(server.VirtualNodes()) != 3 || vnode.Server() != "server2" {
+		t.Errorf("Copies changed with the cluster")
+	}
+}
+
+func TestClusterIntrospection(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+	cluster.AddServer("server2", "5-7")
+
+	if cluster.NumVirtualNodes() != 10 || fmt.Sprint(cluster.Servers()) != "[server1 server2]" {
+		t.Errorf("Unexpected cluster %d %v", cluster.NumVirtualNodes(), cluster.Servers())
+	}
+	if owner, err := cluster.Owner(6); owner != "server2" || err != nil {
+		t.Errorf("Unexpected owner %s %v", owner, err)
+	}
+	if _, err := cluster.Owner(8); err != ErrUnassignedVNode {
+		t.Errorf("Expected ErrUnassignedVNode, got %v", err)
+	}
+	if _, err := cluster.Owner(-1); err != ErrInvalidInput {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+
+	topology := cluster.Topology()
+	if topology.VirtualNodes != 10 || len(topology.Servers) != 2 || fmt.Sprint(topology.Unassigned) != "[8 9]" {
+		t.Errorf("Unexpected topology %v", topology)
+	}
+	if fmt.Sprint(topology.Servers[1].VirtualNodes) != "[5 6 7]" || topology.Owners[0] != "server1" {
+		t.Errorf("Unexpected topology %v", topology)
+	}
+
+	cluster.AddServer("server2", "8-9")
+	if len(topology.Unassigned) != 2 || topology.Owners[8] != "" {
+		t.Errorf("Snapshot changed with the cluster")
+	}
+}
@@ -0,0 +1,98 @@
+package hashring
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Validate checks the internal consistency of the cluster: every virtual
+// node is listed by exactly its owner, virtualToServerMapping agrees with
+// the owners, server names are unique and no retired server is left over as
+// the owner of a virtual node and no server without virtual nodes is left
+// over. Servers with weight 0 are standbys and may own none. It returns a
+// *ValidationError listing every problem found.
+func (hc *HashRingCluster) Validate() error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	problems := []string{}
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(hc.virtualNodes) != hc.numberOfVirtualNodes {
+		addProblem("%d virtual nodes, expected %d", len(hc.virtualNodes), hc.numberOfVirtualNodes)
+	}
+	for i, vnode := range hc.virtualNodes {
+		if vnode.idx != i || vnode.name != strconv.Itoa(i) {
+			addProblem("virtual node %d has index %d and name %q", i, vnode.idx, vnode.name)
+		}
+	}
+
+	names := map[string]bool{}
+	listed := map[*VirtualNodeInfo]*ServerInfo{}
+	inCluster := map[*ServerInfo]bool{}
+	for i, server := range hc.servers {
+		inCluster[server] = true
+		if names[server.name] {
+			addProblem("duplicate server %s", server.name)
+		}
+		names[server.name] = true
+		if server.idx != i {
+			addProblem("server %s has index %d, expected %d", server.name, server.idx, i)
+		}
+		if len(server.virtualNodes) == 0 && server.weight != 0 {
+			addProblem("server %s has no virtual nodes", server.name)
+		}
+
+		for _, vnode := range server.virtualNodes {
+			if other, ok := listed[vnode]; ok {
+				addProblem("virtual node %d listed by %s and %s", vnode.idx, other.name, server.name)
+				continue
+			}
+			listed[vnode] = server
+			if vnode.serverInfo != server {
+				addProblem("virtual node %d listed by %s but owned by %s", vnode.idx, server.name, vnode.Server())
+			}
+		}
+	}
+
+	for _, vnode := range hc.virtualNodes {
+		switch {
+		case vnode.serverInfo == nil:
+		case !inCluster[vnode.serverInfo]:
+			addProblem("virtual node %d owned by retired server %s", vnode.idx, vnode.serverInfo.name)
+		case listed[vnode] == nil:
+			addProblem("virtual node %d owned by %s but not listed", vnode.idx, vnode.serverInfo.name)
+		}
+		if mapped := hc.virtualToServerMapping[vnode.name]; mapped != vnode.serverInfo {
+			mappedName := ""
+			if mapped != nil {
+				mappedName = mapped.name
+			}
+			addProblem("virtualToServerMapping of %d is %q, owner is %q", vnode.idx, mappedName, vnode.Server())
+		}
+	}
+	for name := range hc.virtualToServerMapping {
+		if i, err := strconv.Atoi(name); err != nil || i < 0 || i >= len(hc.virtualNodes) {
+			addProblem("virtualToServerMapping has unknown virtual node %q", name)
+		}
+	}
+
+	migrating := []int{}
+	for i := range hc.migrations {
+		migrating = append(migrating, i)
+	}
+	sort.Ints(migrating)
+	for _, i := range migrating {
+		if i < 0 || i >= len(hc.virtualNodes) || hc.virtualNodes[i].serverInfo == nil {
+			addProblem("migration of unassigned virtual node %d to %s", i, hc.migrations[i])
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package hashring
+
+import (
+	"testing"
+)
+
+func expectProblems(t *testing.T, cluster *HashRingCluster, count int) {
+	err := cluster.Validate()
+	if count == 0 {
+		if err != nil {
+			t.Errorf("Unexpected problems %v", err)
+		}
+		return
+	}
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != count {
+		t.Errorf("Expected %d problems but got %v", count, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cluster := NewHashRingCluster(100)
+	cluster.AddServer("server1", "0-49")
+	cluster.AddServer("server2", "40-99")
+	cluster.Split("server2", "server3")
+	cluster.Rebalance(false)
+	cluster.Undo()
+	cluster.RemoveServer("server3", RemovePolicy{Mode: RemoveSpread})
+	expectProblems(t, cluster, 0)
+}
+
+func TestValidateProblems(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+	cluster.AddServer("server2", "5-9")
+
+	// Listed twice and mapped to the wrong server
+	server1 := cluster.findServer("server1")
+	server1.virtualNodes = append(server1.virtualNodes, cluster.virtualNodes[5])
+	expectProblems(t, cluster, 2)
+	server1.virtualNodes = server1.virtualNodes[:5]
+
+	cluster.virtualToServerMapping["1"] = cluster.findServer("server2")
+	cluster.virtualToServerMapping["x"] = server1
+	expectProblems(t, cluster, 2)
+	cluster.virtualToServerMapping["1"] = server1
+	delete(cluster.virtualToServerMapping, "x")
+
+	cluster.newServer("server1")
+	expectProblems(t, cluster, 2)
+	cluster.retireServer(cluster.servers[2])
+
+	// A retired server that still owns its virtual nodes
+	cluster.retireServer(cluster.findServer("server2"))
+	expectProblems(t, cluster, 5)
+}
+
+func TestValidateEmptyServers(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	cluster.AddServer("server1", "0-4")
+	cluster.AddServer("server2", "5-9")
+	cluster.AddServer("server3", "0")
+	cluster.SetServerWeight("server3", 0)
+	cluster.Rebalance(false)
+	expectProblems(t, cluster, 0)
+
+	// server2 is left over without virtual nodes
+	cluster.AddServer("server4", "5-9")
+	expectProblems(t, cluster, 1)
+
+	zero := 0.0
+	spec := &ClusterSpec{VirtualNodes: 10, Servers: []ServerSpec{{Name: "server1", Ranges: "0-9"}, {Name: "standby", Weight: &zero}}}
+	declared, err := NewClusterFromSpec(spec)
+	if err != nil {
+		t.Fatalf("NewClusterFromSpec failed: %v", err)
+	}
+	expectProblems(t, declared, 0)
+
+	spec.Servers[1].Weight = nil
+	if _, err := NewClusterFromSpec(spec); err == nil {
+		t.Errorf("Empty server with weight 1 accepted")
+	}
+}
+
+func TestRemoveVirtualNodeMissing(t *testing.T) {
+	cluster := NewHashRingCluster(10)
+	vnodes := []*VirtualNodeInfo{cluster.virtualNodes[0], cluster.virtualNodes[1]}
+	if len(removeVirtualNode(vnodes, 5)) != 2 {
+		t.Errorf("Missing virtual node removed another one")
+	}
+	if vnodes = removeVirtualNode(vnodes, 0); len(vnodes) != 1 || vnodes[0].idx != 1 {
+		t.Errorf("Virtual node not removed")
+	}
+}
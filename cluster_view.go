@@ -0,0 +1,73 @@
+package hashring
+
+// clusterView is an immutable snapshot of what lookups need. Changes publish
+// a new view, so lookups never wait for them.
+type clusterView struct {
+	ring             *HashRing
+	slots            bool
+	owners           []string
+	migrations       map[int]string
+	unassignedPolicy UnassignedPolicy
+}
+
+// publish stores a view of the current state for lookups, hc.mu must be
+// held or hc not shared yet.
+func (hc *HashRingCluster) publish() {
+	migrations := make(map[int]string, len(hc.migrations))
+	for i, target := range hc.migrations {
+		migrations[i] = target
+	}
+	hc.view.Store(&clusterView{
+		ring:             hc.ring,
+		slots:            hc.slots,
+		owners:           hc.ownerNames(),
+		migrations:       migrations,
+		unassignedPolicy: hc.unassignedPolicy,
+	})
+}
+
+// publishUnlock publishes the changes made under hc.mu and unlocks it.
+func (hc *HashRingCluster) publishUnlock() {
+	hc.publish()
+	hc.mu.Unlock()
+}
+
+func (hc *HashRingCluster) loadView() *clusterView {
+	if view, ok := hc.view.Load().(*clusterView); ok {
+		return view
+	}
+	return &clusterView{}
+}
+
+// walkVNodes calls fn for the virtual node of key and then for the virtual
+// nodes of every following point clockwise on the ring, until fn returns
+// false. It returns false if the ring is empty. In slot mode it walks the
+// following slots instead.
+func (v *clusterView) walkVNodes(key string, fn func(vnode int) bool) bool {
+	if v.slots {
+		slot := KeySlot(key)
+		for i := slot; i < slot+SlotCount; i++ {
+			if !fn(i % SlotCount) {
+				break
+			}
+		}
+		return true
+	}
+	if v.ring == nil {
+		return false
+	}
+
+	pos, ok := v.ring.GetNodePos(key)
+	if !ok {
+		return false
+	}
+
+	numPoints := v.ring.numPoints()
+	for i := pos; i < pos+numPoints; i++ {
+		// The ring nodes are the virtual node names in index order
+		if !fn(int(v.ring.nodeIndexAt(i % numPoints))) {
+			break
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package hashring
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Run with -race to check lookups against concurrent changes, murmur3
+// v1.1.0 needs -gcflags=all=-d=checkptr=0 with it, see README.md.
+func TestClusterConcurrentAccess(t *testing.T) {
+	cluster := NewHashRingCluster(64)
+	cluster.AddServer("server1", "0-31")
+	cluster.AddServer("server2", "32-63")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := strconv.Itoa(i)
+				if server := cluster.GetServer(key); server == BlackHole {
+					t.Errorf("Key %s without a server", key)
+					return
+				}
+				cluster.GetServers(key, 2)
+				cluster.GetRoute(key)
+				if info := cluster.GetServerInfo("server1"); info != nil {
+					info.VirtualNodes()
+					info.Weight()
+				}
+				cluster.GetVirtualNodeInfo(i % 64).Server()
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		name := "server" + strconv.Itoa(i+3)
+		cluster.AddServer(name, strconv.Itoa(i%64))
+		cluster.Rebalance(false)
+		cluster.BeginMigration("server1", (i+1)%64)
+		cluster.Topology()
+		cluster.Merge(name, "server2")
+		cluster.Undo()
+		cluster.Redo()
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,161 @@
+package hashring
+
+import (
+	"math/bits"
+)
+
+// ringPoint is a point on the continuum. node indexes HashRing.nodes, so a
+// lookup is a binary search over a single flat slice.
+type ringPoint struct {
+	hash uint32
+	node uint32
+}
+
+// eytzPoint is a ringPoint in Eytzinger order, rank is its position in the
+// sorted continuum.
+type eytzPoint struct {
+	hash uint32
+	rank uint32
+}
+
+// searchPoints returns the index of the first point with a hash greater than
+// key, or len(points).
+func searchPoints(points []ringPoint, key uint32) int {
+	lo, hi := 0, len(points)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if points[mid].hash > key {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
+
+// lookupTableBits returns the number of bits of the lookup table for a ring
+// of n points.
+func lookupTableBits(configured int, n int) uint {
+	if configured != autoLookupTable {
+		return uint(configured)
+	}
+	if n < 2 {
+		return 0
+	}
+	b := uint(bits.Len(uint(n - 1)))
+	if b > 20 {
+		b = 20
+	}
+	return b
+}
+
+// buildLookupTable returns 2^bits+1 offsets into points, entry b holds the
+// index of the first point whose top bits are >= b.
+func buildLookupTable(points []ringPoint, tableBits uint) []uint32 {
+	shift := 32 - tableBits
+	buckets := make([]uint32, (1<<tableBits)+1)
+	i := 0
+	for b := range buckets {
+		for i < len(points) && int(points[i].hash>>shift) < b {
+			i++
+		}
+		buckets[b] = uint32(i)
+	}
+	return buckets
+}
+
+// resolveCollisions gives every point of a run of equal hashes to the node
+// chosen by policy. The n points must be sorted stably so runs keep the
+// order the points were generated in.
+func resolveCollisions(n int, sameHash func(i, j int) bool, nodeOf func(i int) *uint32, nodes []string, policy CollisionPolicy) {
+	for start := 0; start < n; {
+		end := start + 1
+		for end < n && sameHash(start, end) {
+			end++
+		}
+
+		if end-start > 1 {
+			winner := *nodeOf(end - 1)
+			switch policy {
+			case CollisionFirstWins:
+				winner = *nodeOf(start)
+			case CollisionLowestNode:
+				for i := start; i < end; i++ {
+					if nodes[*nodeOf(i)] < nodes[winner] {
+						winner = *nodeOf(i)
+					}
+				}
+			}
+			for i := start; i < end; i++ {
+				*nodeOf(i) = winner
+			}
+		}
+		start = end
+	}
+}
+
+// buildEytzinger lays out the sorted points as an implicit binary tree,
+// 1-indexed, so the first levels of every search share cache lines.
+func buildEytzinger(points []ringPoint) []eytzPoint {
+	eytz := make([]eytzPoint, len(points)+1)
+	fillEytzinger(points, eytz, 0, 1)
+	return eytz
+}
+
+func fillEytzinger(points []ringPoint, eytz []eytzPoint, i int, k int) int {
+	if k < len(eytz) {
+		i = fillEytzinger(points, eytz, i, 2*k)
+		eytz[k] = eytzPoint{hash: points[i].hash, rank: uint32(i)}
+		i++
+		i = fillEytzinger(points, eytz, i, 2*k+1)
+	}
+	return i
+}
+
+// searchEytzinger returns the sorted position of the first point with a hash
+// greater than key, or the number of points.
+func searchEytzinger(eytz []eytzPoint, key uint32) int {
+	k := 1
+	for k < len(eytz) {
+		if eytz[k].hash > key {
+			k = 2 * k
+		} else {
+			k = 2*k + 1
+		}
+	}
+	// Undo the right turns taken after the last left turn
+	k >>= uint(bits.TrailingZeros(^uint(k))) + 1
+	if k == 0 {
+		return len(eytz) - 1
+	}
+	return int(eytz[k].rank)
+}
+
+// overlapArcs walks two sorted continua together and calls fn for every
+// stretch of keys with the nodes it maps to on either continuum. A point
+// owns the keys from the previous point up to its own hash.
+func overlapArcs(a []ringPoint, b []ringPoint, fn func(aNode uint32, bNode uint32, length uint64)) {
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+
+	i, j := 0, 0
+	for start := uint64(0); start < 1<<32; {
+		for i < len(a) && uint64(a[i].hash) <= start {
+			i++
+		}
+		for j < len(b) && uint64(b[j].hash) <= start {
+			j++
+		}
+		end := uint64(1 << 32)
+		if i < len(a) && uint64(a[i].hash) < end {
+			end = uint64(a[i].hash)
+		}
+		if j < len(b) && uint64(b[j].hash) < end {
+			end = uint64(b[j].hash)
+		}
+		// Past the last point keys wrap to the first one
+		fn(a[i%len(a)].node, b[j%len(b)].node, end-start)
+		start = end
+	}
+}
@@ -0,0 +1,88 @@
+package hashring
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSearchEytzinger(t *testing.T) {
+	for n := 0; n < 70; n++ {
+		points := make([]ringPoint, n)
+		for i := range points {
+			points[i].hash = uint32(i * 10)
+		}
+		eytz := buildEytzinger(points)
+
+		for key := uint32(0); key < uint32(n*10+10); key++ {
+			expected := searchPoints(points, key)
+			if pos := searchEytzinger(eytz, key); pos != expected {
+				t.Fatalf("%d points: searchEytzinger(%d) expected %d but got %d", n, key, expected, pos)
+			}
+		}
+	}
+}
+
+func TestEytzingerLayoutMatchesSorted(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e", "f", "g"}
+	sorted := New(nodes)
+	eytz := NewRing(nodes, WithEytzingerLayout())
+
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		ePos, _ := sorted.GetNodePos(key)
+		aPos, _ := eytz.GetNodePos(key)
+		if ePos != aPos {
+			t.Fatalf("GetNodePos(%s) expected %d but got %d", key, ePos, aPos)
+		}
+	}
+	expectSamePlacement(t, sorted, eytz)
+	expectSamePlacement(t, sorted.AddNode("h"), eytz.AddNode("h"))
+}
+
+func TestLookupTable(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e", "f", "g"}
+	plain := NewRing(nodes, WithLookupTable(0))
+	if plain.buckets != nil {
+		t.Fatal("WithLookupTable(0) should disable the lookup table")
+	}
+
+	for _, tableBits := range []int{1, 4, 10, 16} {
+		ring := NewRing(nodes, WithLookupTable(tableBits))
+		if len(ring.buckets) != 1<<uint(tableBits)+1 {
+			t.Fatalf("expected %d buckets but got %d", 1<<uint(tableBits)+1, len(ring.buckets))
+		}
+		for i := 0; i < 10000; i++ {
+			key := strconv.Itoa(i)
+			ePos, _ := plain.GetNodePos(key)
+			aPos, _ := ring.GetNodePos(key)
+			if ePos != aPos {
+				t.Fatalf("%d bits: GetNodePos(%s) expected %d but got %d", tableBits, key, ePos, aPos)
+			}
+		}
+	}
+
+	ring := New(nodes)
+	if len(ring.buckets) != 1<<10+1 {
+		t.Errorf("expected an automatic table of %d buckets for %d points but got %d", 1<<10+1, len(ring.points), len(ring.buckets))
+	}
+	ring = ring.RemoveNode("a").AddNode("h")
+	if ring.buckets == nil {
+		t.Error("lookup table not rebuilt")
+	}
+	expectSamePlacement(t, plain.RemoveNode("a").AddNode("h"), ring)
+}
+
+func TestLookupTableEdges(t *testing.T) {
+	points := []ringPoint{{0, 0}, {1 << 31, 1}, {1<<32 - 1, 2}}
+	buckets := buildLookupTable(points, 1)
+	if buckets[0] != 0 || buckets[1] != 1 || buckets[2] != 3 {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+
+	if lookupTableBits(autoLookupTable, 0) != 0 || lookupTableBits(autoLookupTable, 1) != 0 {
+		t.Error("tiny rings should not get a lookup table")
+	}
+	if lookupTableBits(autoLookupTable, 1<<30) != 20 {
+		t.Error("automatic lookup table should be capped")
+	}
+}
@@ -16,21 +16,18 @@ func (h HashKeyOrder) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
 func (h HashKeyOrder) Less(i, j int) bool { return h[i] < h[j] }
 
 type HashRing struct {
-	ring       map[HashKey]string
-	sortedKeys []HashKey
-	nodes      []string
-	weights    map[string]int
+	points      []ringPoint
+	points64    []ringPoint64
+	eytz        []eytzPoint
+	buckets     []uint32
+	bucketShift uint
+	nodes       []string
+	weights     map[string]int
+	config      ringConfig
 }
 
 func New(nodes []string) *HashRing {
-	hashRing := &HashRing{
-		ring:       make(map[HashKey]string),
-		sortedKeys: make([]HashKey, 0),
-		nodes:      nodes,
-		weights:    make(map[string]int),
-	}
-	hashRing.generateCircle()
-	return hashRing
+	return NewRing(nodes)
 }
 
 func NewWithWeights(weights map[string]int) *HashRing {
@@ -38,14 +35,7 @@ func NewWithWeights(weights map[string]int) *HashRing {
 	for node, _ := range weights {
 		nodes = append(nodes, node)
 	}
-	hashRing := &HashRing{
-		ring:       make(map[HashKey]string),
-		sortedKeys: make([]HashKey, 0),
-		nodes:      nodes,
-		weights:    weights,
-	}
-	hashRing.generateCircle()
-	return hashRing
+	return NewRing(nodes, WithWeights(weights))
 }
 
 func (h *HashRing) Size() int {
@@ -67,15 +57,54 @@ func (h *HashRing) UpdateWithWeights(weights map[string]int) {
 	}
 
 	if nodesChgFlg {
-		newhring := NewWithWeights(weights)
+		nodes := make([]string, 0, len(weights))
+		for node, _ := range weights {
+			nodes = append(nodes, node)
+		}
+		newhring := h.rebuild(nodes, weights)
 		h.weights = newhring.weights
 		h.nodes = newhring.nodes
-		h.ring = newhring.ring
-		h.sortedKeys = newhring.sortedKeys
+		h.points = newhring.points
+		h.points64 = newhring.points64
+		h.eytz = newhring.eytz
+		h.buckets = newhring.buckets
+		h.bucketShift = newhring.bucketShift
+		h.config = newhring.config
 	}
 }
 
 func (h *HashRing) generateCircle() {
+	if h.config.hashSpace64 {
+		h.generateCircle64()
+		return
+	}
+
+	h.eachDigest(func(nodeIndex int, bKey [md5.Size]byte) {
+		for i := 0; i < 3; i++ {
+			key := hashVal(bKey[i*4 : i*4+4])
+			h.points = append(h.points, ringPoint{hash: uint32(key), node: uint32(nodeIndex)})
+		}
+	})
+
+	// Stable, so colliding points stay in generation order for the policy
+	points := h.points
+	sort.SliceStable(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	resolveCollisions(len(points),
+		func(i, j int) bool { return points[i].hash == points[j].hash },
+		func(i int) *uint32 { return &points[i].node },
+		h.nodes, h.config.collisionPolicy)
+
+	if h.config.eytzinger {
+		h.eytz = buildEytzinger(h.points)
+	} else if bits := lookupTableBits(h.config.lookupTableBits, len(h.points)); bits > 0 {
+		h.buckets = buildLookupTable(h.points, bits)
+		h.bucketShift = 32 - bits
+	}
+}
+
+// eachDigest calls fn with the md5 digests every node contributes to the
+// ring, in generation order.
+func (h *HashRing) eachDigest(fn func(nodeIndex int, bKey [md5.Size]byte)) {
 	totalWeight := 0
 	for _, node := range h.nodes {
 		if weight, ok := h.weights[node]; ok {
@@ -85,28 +114,20 @@ func (h *HashRing) generateCircle() {
 		}
 	}
 
-	for _, node := range h.nodes {
+	for nodeIndex, node := range h.nodes {
 		weight := 1
 
 		if _, ok := h.weights[node]; ok {
 			weight = h.weights[node]
 		}
 
-		factor := math.Floor(float64(40*len(h.nodes)*weight) / float64(totalWeight))
+		factor := math.Floor(float64(h.config.pointsPerNode*len(h.nodes)*weight) / float64(totalWeight))
 
 		for j := 0; j < int(factor); j++ {
 			nodeKey := fmt.Sprintf("%s-%d", node, j)
-			bKey := hashDigest(nodeKey)
-
-			for i := 0; i < 3; i++ {
-				key := hashVal(bKey[i*4 : i*4+4])
-				h.ring[key] = node
-				h.sortedKeys = append(h.sortedKeys, key)
-			}
+			fn(nodeIndex, hashDigest(nodeKey))
 		}
 	}
-
-	sort.Sort(HashKeyOrder(h.sortedKeys))
 }
 
 func (h *HashRing) GetNode(stringKey string) (node string, ok bool) {
@@ -114,20 +135,31 @@ func (h *HashRing) GetNode(stringKey string) (node string, ok bool) {
 	if !ok {
 		return "", false
 	}
-	return h.ring[h.sortedKeys[pos]], true
+	return h.nodes[h.nodeIndexAt(pos)], true
 }
 
 func (h *HashRing) GetNodePos(stringKey string) (pos int, ok bool) {
-	if len(h.ring) == 0 {
+	if h.config.hashSpace64 {
+		return h.getNodePos64(stringKey)
+	}
+
+	if len(h.points) == 0 {
 		return 0, false
 	}
 
-	key := h.GenKey(stringKey)
+	key := uint32(h.GenKey(stringKey))
 
-	nodes := h.sortedKeys
-	pos = sort.Search(len(nodes), func(i int) bool { return nodes[i] > key })
+	if h.buckets != nil {
+		b := key >> h.bucketShift
+		lo, hi := h.buckets[b], h.buckets[b+1]
+		pos = int(lo) + searchPoints(h.points[lo:hi], key)
+	} else if h.eytz != nil {
+		pos = searchEytzinger(h.eytz, key)
+	} else {
+		pos = searchPoints(h.points, key)
+	}
 
-	if pos == len(nodes) {
+	if pos == len(h.points) {
 		// Wrap the search, should return first node
 		return 0, true
 	} else {
@@ -138,6 +170,9 @@ func (h *HashRing) GetNodePos(stringKey string) (pos int, ok bool) {
 func (h *HashRing) GenKey(key string) HashKey {
 	//bKey := hashDigest(key)
 	//return hashVal(bKey[0:4])
+	if h.config.hasher != nil {
+		return h.config.hasher(key)
+	}
 	return HashKey(murmur3.Sum32([]byte(key)))
 }
 
@@ -151,13 +186,17 @@ func (h *HashRing) GetNodes(stringKey string, size int) (nodes []string, ok bool
 		return nil, false
 	}
 
+	if h.config.replicaStrategy != nil {
+		resultSlice := h.config.replicaStrategy.Replicas(h, pos, size)
+		return resultSlice, len(resultSlice) == size
+	}
+
 	returnedValues := make(map[string]bool, size)
-	//mergedSortedKeys := append(h.sortedKeys[pos:], h.sortedKeys[:pos]...)
 	resultSlice := make([]string, 0, size)
 
-	for i := pos; i < pos+len(h.sortedKeys); i++ {
-		key := h.sortedKeys[i%len(h.sortedKeys)]
-		val := h.ring[key]
+	numPoints := h.numPoints()
+	for i := pos; i < pos+numPoints; i++ {
+		val := h.nodes[h.nodeIndexAt(i%numPoints)]
 		if !returnedValues[val] {
 			returnedValues[val] = true
 			resultSlice = append(resultSlice, val)
@@ -170,6 +209,35 @@ func (h *HashRing) GetNodes(stringKey string, size int) (nodes []string, ok bool
 	return resultSlice, len(resultSlice) == size
 }
 
+func (h *HashRing) numPoints() int {
+	if h.config.hashSpace64 {
+		return len(h.points64)
+	}
+	return len(h.points)
+}
+
+// nodeIndexAt returns the index into h.nodes of the point at pos.
+func (h *HashRing) nodeIndexAt(pos int) uint32 {
+	if h.config.hashSpace64 {
+		return h.points64[pos].node
+	}
+	return h.points[pos].node
+}
+
+// arcFraction returns the fraction of the continuum that maps to the point
+// at pos, the arc from the previous point up to it.
+func (h *HashRing) arcFraction(pos int) float64 {
+	n := h.numPoints()
+	if n == 1 {
+		return 1
+	}
+	prev := (pos + n - 1) % n
+	if h.config.hashSpace64 {
+		return float64(h.points64[pos].hash-h.points64[prev].hash) / math.Pow(2, 64)
+	}
+	return float64(h.points[pos].hash-h.points[prev].hash) / math.Pow(2, 32)
+}
+
 func (h *HashRing) AddNode(node string) *HashRing {
 	return h.AddWeightedNode(node, 1)
 }
@@ -195,14 +263,7 @@ func (h *HashRing) AddWeightedNode(node string, weight int) *HashRing {
 	}
 	weights[node] = weight
 
-	hashRing := &HashRing{
-		ring:       make(map[HashKey]string),
-		sortedKeys: make([]HashKey, 0),
-		nodes:      nodes,
-		weights:    weights,
-	}
-	hashRing.generateCircle()
-	return hashRing
+	return h.rebuild(nodes, weights)
 }
 
 func (h *HashRing) UpdateWeightedNode(node string, weight int) *HashRing {
@@ -224,14 +285,7 @@ func (h *HashRing) UpdateWeightedNode(node string, weight int) *HashRing {
 	}
 	weights[node] = weight
 
-	hashRing := &HashRing{
-		ring:       make(map[HashKey]string),
-		sortedKeys: make([]HashKey, 0),
-		nodes:      nodes,
-		weights:    weights,
-	}
-	hashRing.generateCircle()
-	return hashRing
+	return h.rebuild(nodes, weights)
 }
 func (h *HashRing) RemoveNode(node string) *HashRing {
 	nodes := make([]string, 0)
@@ -253,11 +307,25 @@ func (h *HashRing) RemoveNode(node string) *HashRing {
 		}
 	}
 
+	hashRing := h.rebuild(nodes, weights)
+	if _, ok := h.config.metadata[node]; ok {
+		hashRing.config.metadata = make(map[string]map[string]string, len(h.config.metadata))
+		for eNode, md := range h.config.metadata {
+			if eNode != node {
+				hashRing.config.metadata[eNode] = md
+			}
+		}
+	}
+	return hashRing
+}
+
+// rebuild generates a new ring for nodes and weights that keeps the options
+// h was created with.
+func (h *HashRing) rebuild(nodes []string, weights map[string]int) *HashRing {
 	hashRing := &HashRing{
-		ring:       make(map[HashKey]string),
-		sortedKeys: make([]HashKey, 0),
-		nodes:      nodes,
-		weights:    weights,
+		nodes:   nodes,
+		weights: weights,
+		config:  h.config,
 	}
 	hashRing.generateCircle()
 	return hashRing
@@ -0,0 +1,71 @@
+package hashring
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashSpace64(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d", "e"}
+	ring := NewRing(nodes, WithHashSpace64())
+
+	if len(ring.points) != 0 || len(ring.points64) != 5*defaultPointsPerNode*2 {
+		t.Fatalf("expected %d 64-bit points but got %d (and %d 32-bit)", 5*defaultPointsPerNode*2, len(ring.points64), len(ring.points))
+	}
+
+	plain := NewRing(nodes, WithHashSpace64(), WithLookupTable(0))
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		node, ok := ring.GetNode(key)
+		if !ok {
+			t.Fatalf("GetNode(%s) failed", key)
+		}
+		counts[node]++
+
+		ePos, _ := plain.GetNodePos(key)
+		aPos, _ := ring.GetNodePos(key)
+		if ePos != aPos {
+			t.Fatalf("GetNodePos(%s) expected %d but got %d", key, ePos, aPos)
+		}
+
+		expected := plain.points64[searchPoints64(plain.points64, ring.GenKey64(key))%len(plain.points64)]
+		if nodes[expected.node] != node {
+			t.Fatalf("GetNode(%s) expected %s but got %s", key, nodes[expected.node], node)
+		}
+	}
+	if len(counts) != 5 {
+		t.Errorf("keys not spread over all nodes %v", counts)
+	}
+
+	replicas, ok := ring.GetNodes("test", 3)
+	if !ok || len(replicas) != 3 {
+		t.Errorf("GetNodes(test, 3) failed %v", replicas)
+	}
+}
+
+func TestHashSpace64Mutations(t *testing.T) {
+	ring := NewRing([]string{"a", "b", "c"}, WithHashSpace64())
+	ring = ring.AddNode("d").RemoveNode("a")
+	if len(ring.points64) != 3*defaultPointsPerNode*2 {
+		t.Errorf("mutations lost the 64-bit mode, got %d points", len(ring.points64))
+	}
+
+	expected := NewRing([]string{"b", "c", "d"}, WithHashSpace64())
+	expectSamePlacement(t, expected, ring)
+}
+
+func TestHashSpace64Empty(t *testing.T) {
+	ring := NewRing(nil, WithHashSpace64())
+	if node, ok := ring.GetNode("test"); ok || node != "" {
+		t.Errorf("GetNode(test) expected (\"\", false) but got (%s, %v)", node, ok)
+	}
+}
+
+func TestHasher64(t *testing.T) {
+	ring := NewRing([]string{"a", "b", "c"}, WithHashSpace64(), WithHasher64(func(key string) uint64 { return 0 }))
+	first := ring.nodes[ring.points64[0].node]
+	for _, key := range []string{"test", "test1", "aaaa"} {
+		expectNode(t, ring, key, first)
+	}
+}
@@ -508,6 +508,50 @@ func BenchmarkHashesSingle(b *testing.B) {
 	}
 }
 
+func BenchmarkHashesEytzinger(b *testing.B) {
+	nodes := []string{"a", "b", "c", "d", "e", "f", "g"}
+	hashRing := NewRing(nodes, WithEytzingerLayout())
+	keys := []string{"test", "test", "test1", "test2", "test3", "test4", "test5", "aaaa", "bbbb"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hashRing.GetNodes(keys[i%len(keys)], 2)
+	}
+}
+
+func BenchmarkHashesSingleEytzinger(b *testing.B) {
+	nodes := []string{"a", "b", "c", "d", "e", "f", "g"}
+	hashRing := NewRing(nodes, WithEytzingerLayout())
+	keys := []string{"test", "test", "test1", "test2", "test3", "test4", "test5", "aaaa", "bbbb"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hashRing.GetNode(keys[i%len(keys)])
+	}
+}
+
+func benchmarkLargeRing(b *testing.B, opts ...Option) {
+	nodes := make([]string, 500)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("192.168.%d.%d:11212", i/256, i%256)
+	}
+	hashRing := NewRing(nodes, opts...)
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hashRing.GetNode(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkLargeRing(b *testing.B) {
+	benchmarkLargeRing(b)
+}
+
+func BenchmarkLargeRingNoLookupTable(b *testing.B) {
+	benchmarkLargeRing(b, WithLookupTable(0))
+}
+
 // Test Weights distribution
 // Test Hashing Distribution on various datatypes ID Location
 // Performance test
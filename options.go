@@ -0,0 +1,255 @@
+package hashring
+
+import (
+	"sort"
+)
+
+const (
+	defaultPointsPerNode = 40
+	// autoLookupTable sizes the lookup table from the number of points.
+	autoLookupTable    = -1
+	maxLookupTableBits = 24
+)
+
+// Hasher maps a lookup key onto the continuum.
+type Hasher func(key string) HashKey
+
+// CollisionPolicy decides which node owns a point when the points of two
+// nodes hash to the same key.
+type CollisionPolicy int
+
+const (
+	// CollisionLastWins gives the point to the node generated last.
+	// This is the behavior of New and NewWithWeights.
+	CollisionLastWins CollisionPolicy = iota
+	// CollisionFirstWins keeps the point with the node generated first.
+	CollisionFirstWins
+	// CollisionLowestNode gives the point to the node with the smallest
+	// name, so placement does not depend on the order nodes were added in.
+	CollisionLowestNode
+)
+
+// ReplicaStrategy picks the nodes returned by GetNodes, starting from the
+// ring position pos of the key.
+type ReplicaStrategy interface {
+	Replicas(h *HashRing, pos int, size int) []string
+}
+
+type ringConfig struct {
+	hasher          Hasher
+	pointsPerNode   int
+	metadata        map[string]map[string]string
+	collisionPolicy CollisionPolicy
+	replicaStrategy ReplicaStrategy
+	eytzinger       bool
+	lookupTableBits int
+	hashSpace64     bool
+	hasher64        Hasher64
+}
+
+func defaultRingConfig() ringConfig {
+	return ringConfig{
+		pointsPerNode:   defaultPointsPerNode,
+		lookupTableBits: autoLookupTable,
+	}
+}
+
+// Option configures a HashRing created by NewRing.
+type Option func(*HashRing)
+
+// NewRing creates a ring for nodes configured by opts. Without options it
+// places nodes exactly like New.
+func NewRing(nodes []string, opts ...Option) *HashRing {
+	hashRing := &HashRing{
+		nodes:   nodes,
+		weights: make(map[string]int),
+		config:  defaultRingConfig(),
+	}
+	for _, opt := range opts {
+		opt(hashRing)
+	}
+	hashRing.generateCircle()
+	return hashRing
+}
+
+// WithHasher replaces the murmur3 hash used for lookup keys.
+func WithHasher(hasher Hasher) Option {
+	return func(h *HashRing) {
+		if hasher != nil {
+			h.config.hasher = hasher
+		}
+	}
+}
+
+// WithPointsPerNode sets the average number of md5 digests generated per
+// node. Every digest gives 3 points on the ring. The default is 40.
+func WithPointsPerNode(points int) Option {
+	return func(h *HashRing) {
+		if points > 0 {
+			h.config.pointsPerNode = points
+		}
+	}
+}
+
+// WithWeights sets node weights. Weighted nodes that are missing from the
+// node list are added to it in sorted order.
+func WithWeights(weights map[string]int) Option {
+	return func(h *HashRing) {
+		known := make(map[string]bool, len(h.nodes))
+		for _, node := range h.nodes {
+			known[node] = true
+		}
+
+		missing := make([]string, 0)
+		copied := make(map[string]int, len(weights))
+		for node, weight := range weights {
+			copied[node] = weight
+			if !known[node] {
+				missing = append(missing, node)
+			}
+		}
+		sort.Strings(missing)
+
+		if len(missing) > 0 {
+			nodes := make([]string, len(h.nodes), len(h.nodes)+len(missing))
+			copy(nodes, h.nodes)
+			h.nodes = append(nodes, missing...)
+		}
+		h.weights = copied
+	}
+}
+
+// WithNodeMetadata attaches metadata such as a zone or rack to node.
+func WithNodeMetadata(node string, metadata map[string]string) Option {
+	return func(h *HashRing) {
+		all := make(map[string]map[string]string, len(h.config.metadata)+1)
+		for eNode, md := range h.config.metadata {
+			all[eNode] = md
+		}
+		md := make(map[string]string, len(metadata))
+		for k, v := range metadata {
+			md[k] = v
+		}
+		all[node] = md
+		h.config.metadata = all
+	}
+}
+
+// WithCollisionPolicy sets how colliding points are resolved.
+func WithCollisionPolicy(policy CollisionPolicy) Option {
+	return func(h *HashRing) {
+		h.config.collisionPolicy = policy
+	}
+}
+
+// WithReplicaStrategy sets the strategy used by GetNodes.
+func WithReplicaStrategy(strategy ReplicaStrategy) Option {
+	return func(h *HashRing) {
+		h.config.replicaStrategy = strategy
+	}
+}
+
+// WithEytzingerLayout keeps an extra copy of the continuum in Eytzinger
+// (breadth-first) order, which makes lookups on large rings more cache
+// friendly at the cost of 8 bytes per point.
+func WithEytzingerLayout() Option {
+	return func(h *HashRing) {
+		h.config.eytzinger = true
+	}
+}
+
+// WithLookupTable sets the size of the lookup table to 2^bits buckets. Each
+// bucket costs 4 bytes and stores the first point of its slice of the hash
+// space, so lookups only search the points of one bucket. By default the
+// table gets about one bucket per point, bits 0 disables it. The table is
+// not used together with WithEytzingerLayout.
+func WithLookupTable(bits int) Option {
+	return func(h *HashRing) {
+		if bits >= 0 && bits <= maxLookupTableBits {
+			h.config.lookupTableBits = bits
+		}
+	}
+}
+
+// Metadata returns the metadata attached to node, or nil.
+func (h *HashRing) Metadata(node string) map[string]string {
+	md, ok := h.config.metadata[node]
+	if !ok {
+		return nil
+	}
+	copied := make(map[string]string, len(md))
+	for k, v := range md {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Walk calls fn for the node of every point clockwise from pos, until fn
+// returns false or the ring has been walked once.
+func (h *HashRing) Walk(pos int, fn func(node string) bool) {
+	numPoints := h.numPoints()
+	for i := pos; i < pos+numPoints; i++ {
+		if !fn(h.nodes[h.nodeIndexAt(i%numPoints)]) {
+			return
+		}
+	}
+}
+
+type distinctNodes struct{}
+
+func (distinctNodes) Replicas(h *HashRing, pos int, size int) []string {
+	seen := make(map[string]bool, size)
+	result := make([]string, 0, size)
+	h.Walk(pos, func(node string) bool {
+		if !seen[node] {
+			seen[node] = true
+			result = append(result, node)
+		}
+		return len(result) < size
+	})
+	return result
+}
+
+// DistinctNodes returns the first size distinct nodes clockwise. It is the
+// default strategy.
+var DistinctNodes ReplicaStrategy = distinctNodes{}
+
+type distinctMetadata struct {
+	key string
+}
+
+func (s distinctMetadata) Replicas(h *HashRing, pos int, size int) []string {
+	seen := make(map[string]bool, size)
+	values := make(map[string]bool, size)
+	result := make([]string, 0, size)
+	h.Walk(pos, func(node string) bool {
+		value, ok := h.config.metadata[node][s.key]
+		if !seen[node] && (!ok || !values[value]) {
+			seen[node] = true
+			if ok {
+				values[value] = true
+			}
+			result = append(result, node)
+		}
+		return len(result) < size
+	})
+
+	// Not enough distinct values, fill up with the remaining nodes.
+	if len(result) < size {
+		h.Walk(pos, func(node string) bool {
+			if !seen[node] {
+				seen[node] = true
+				result = append(result, node)
+			}
+			return len(result) < size
+		})
+	}
+	return result
+}
+
+// DistinctMetadata prefers replicas whose metadata value for key differs,
+// e.g. DistinctMetadata("zone") spreads replicas across zones. Nodes are
+// reused across values only when there are fewer values than replicas.
+func DistinctMetadata(key string) ReplicaStrategy {
+	return distinctMetadata{key: key}
+}
@@ -0,0 +1,143 @@
+package hashring
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func expectSamePlacement(t *testing.T, expected *HashRing, actual *HashRing) {
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		eNode, _ := expected.GetNode(key)
+		aNode, _ := actual.GetNode(key)
+		if eNode != aNode {
+			t.Fatalf("GetNode(%s) expected %s but got %s", key, eNode, aNode)
+		}
+		eNodes, _ := expected.GetNodes(key, 2)
+		aNodes, _ := actual.GetNodes(key, 2)
+		if !reflect.DeepEqual(eNodes, aNodes) {
+			t.Fatalf("GetNodes(%s) expected %v but got %v", key, eNodes, aNodes)
+		}
+	}
+}
+
+func TestNewRingMatchesNew(t *testing.T) {
+	nodes := []string{"a", "b", "c"}
+	expectSamePlacement(t, New(nodes), NewRing(nodes))
+}
+
+func TestNewRingWithWeights(t *testing.T) {
+	weights := map[string]int{"a": 1, "b": 2, "c": 1}
+	ring := NewRing(nil, WithWeights(weights))
+
+	if ring.Size() != 3 {
+		t.Errorf("Size() expected 3 but got %d", ring.Size())
+	}
+	expectSamePlacement(t, NewWithWeights(weights), ring)
+}
+
+func TestNewRingPointsPerNode(t *testing.T) {
+	nodes := []string{"a", "b", "c"}
+	ring := NewRing(nodes, WithPointsPerNode(10))
+	if len(ring.points) != 3*10*3 {
+		t.Errorf("expected %d points but got %d", 3*10*3, len(ring.points))
+	}
+
+	ring = NewRing(nodes, WithPointsPerNode(0))
+	if len(ring.points) != 3*defaultPointsPerNode*3 {
+		t.Errorf("invalid point count should be ignored, got %d points", len(ring.points))
+	}
+}
+
+func TestNewRingHasher(t *testing.T) {
+	ring := NewRing([]string{"a", "b", "c"}, WithHasher(func(key string) HashKey { return 0 }))
+	first := ring.nodes[ring.points[0].node]
+	for _, key := range []string{"test", "test1", "aaaa"} {
+		expectNode(t, ring, key, first)
+	}
+}
+
+func TestCollisionPolicy(t *testing.T) {
+	nodes := []string{"c", "a", "b"}
+	for _, tc := range []struct {
+		policy   CollisionPolicy
+		expected string
+	}{
+		{CollisionLastWins, "b"},
+		{CollisionFirstWins, "c"},
+		{CollisionLowestNode, "a"},
+	} {
+		points := []ringPoint{{0, 2}, {1, 0}, {1, 1}, {1, 2}, {2, 0}}
+		resolveCollisions(len(points),
+			func(i, j int) bool { return points[i].hash == points[j].hash },
+			func(i int) *uint32 { return &points[i].node },
+			nodes, tc.policy)
+		for _, p := range points[1:4] {
+			if nodes[p.node] != tc.expected {
+				t.Errorf("policy %d expected %s but got %s", tc.policy, tc.expected, nodes[p.node])
+			}
+		}
+		if nodes[points[0].node] != "b" || nodes[points[4].node] != "c" {
+			t.Errorf("policy %d changed points without collisions", tc.policy)
+		}
+	}
+}
+
+func TestOptionsSurviveMutations(t *testing.T) {
+	ring := NewRing([]string{"a", "b"},
+		WithPointsPerNode(10),
+		WithNodeMetadata("a", map[string]string{"zone": "1"}),
+		WithNodeMetadata("b", map[string]string{"zone": "2"}))
+
+	ring = ring.AddNode("c")
+	if len(ring.points) != 3*10*3 {
+		t.Errorf("AddNode lost the point count, got %d points", len(ring.points))
+	}
+	if ring.Metadata("a")["zone"] != "1" {
+		t.Errorf("AddNode lost metadata %v", ring.Metadata("a"))
+	}
+
+	ring = ring.RemoveNode("a")
+	if ring.Metadata("a") != nil {
+		t.Errorf("RemoveNode kept metadata %v", ring.Metadata("a"))
+	}
+	if ring.Metadata("b")["zone"] != "2" {
+		t.Errorf("RemoveNode dropped metadata of b %v", ring.Metadata("b"))
+	}
+}
+
+func TestDistinctMetadataStrategy(t *testing.T) {
+	ring := NewRing([]string{"a1", "a2", "b1", "b2", "c1"},
+		WithNodeMetadata("a1", map[string]string{"zone": "a"}),
+		WithNodeMetadata("a2", map[string]string{"zone": "a"}),
+		WithNodeMetadata("b1", map[string]string{"zone": "b"}),
+		WithNodeMetadata("b2", map[string]string{"zone": "b"}),
+		WithNodeMetadata("c1", map[string]string{"zone": "c"}),
+		WithReplicaStrategy(DistinctMetadata("zone")))
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		nodes, ok := ring.GetNodes(key, 3)
+		if !ok {
+			t.Fatalf("GetNodes(%s, 3) failed", key)
+		}
+		zones := map[string]bool{}
+		for _, node := range nodes {
+			zones[ring.Metadata(node)["zone"]] = true
+		}
+		if len(zones) != 3 {
+			t.Errorf("GetNodes(%s, 3) expected 3 zones but got %v", key, nodes)
+		}
+
+		nodes, ok = ring.GetNodes(key, 5)
+		if !ok || len(nodes) != 5 {
+			t.Errorf("GetNodes(%s, 5) expected all nodes but got %v", key, nodes)
+		}
+	}
+}
+
+func TestDistinctNodesStrategy(t *testing.T) {
+	nodes := []string{"a", "b", "c", "d"}
+	expectSamePlacement(t, New(nodes), NewRing(nodes, WithReplicaStrategy(DistinctNodes)))
+}